@@ -2,52 +2,69 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/fake"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
 )
 
+// testResponse wraps the forecasts of each provider with their credits.
+type testResponse struct {
+	Providers struct {
+		OpenMeteo  testProvider `json:"openmeteo"`
+		WeatherAPI testProvider `json:"weatherapi"`
+	} `json:"providers"`
+}
+
+// testProvider holds the forecast of one provider.
+type testProvider struct {
+	Forecast types.DailyForecast `json:"forecast"`
+}
+
 // result type is used to unmarshal the received json into. I hardcode it for
 // testing convenience.
 type testResult struct {
-	WeatherAPI1 types.FiveDayForecast `json:"weatherAPI1"`
-	WeatherAPI2 types.FiveDayForecast `json:"weatherAPI2"`
+	OpenMeteo  types.DailyForecast
+	WeatherAPI types.DailyForecast
 }
 
 // TestGetWeatherEndpoint_ReturnsResult verifies the output contains both external
-// endpoints.
-// It will fail each day due to the reason of getting forecasts from today until
-// in five days.
-//
-// As I wanted to verify the happy path during development it did what I needed.
-// Although useless for CI/CD every human can verify the data structure itself.
+// endpoints. They are faked, so the test runs offline and on any day, with the
+// forecasts starting today.
 func TestGetWeatherEndpoint_ReturnsResult(t *testing.T) {
-	t.Log("This test runs against the real forecast endpoints.")
-	t.Log("So it might break every single day.")
-	// Technical Debt: This runs a test with the default HTTP client against the
-	// real endpoint as I cannot inject some pre-configured http.Client.
-	// So the response data will change at least daily, maybe even within the day
-	// as forecasts get updated.
-	// Using another net/httptest server for reproducable responses would be better.
-	key, err := apiKey()
+	openMeteo := fake.NewOpenMeteo(t)
+	weatherAPI := fake.NewWeatherAPI(t, "secret")
+	weatherAPI.SetDays(
+		fake.Day{MaxTemp: 19.8},
+		fake.Day{MaxTemp: 22.1},
+		fake.Day{MaxTemp: 21},
+		fake.Day{MaxTemp: 19},
+		fake.Day{MaxTemp: 19},
+	)
+
+	providers, err := newRegistry(ProvidersConfig{
+		Order:      []string{"openmeteo", "weatherapi"},
+		OpenMeteo:  openMeteoConfig{Enabled: true, URL: openMeteo.URL},
+		WeatherApi: weatherApiConfig{Enabled: true, Key: "secret", URL: weatherAPI.URL},
+	})
 	if err != nil {
-		t.Errorf("get API key: %+v", err)
+		t.Errorf("set up providers: %+v", err)
 		t.Fatal("Aborting")
 	}
-	sut := api.NewServer(api.Config{WeatherApiKey: key})
+	sut := api.NewServer(api.Config{Providers: providers})
 
 	srv := httptest.NewServer(sut.Handler())
+	t.Cleanup(srv.Close)
 	c := srv.Client()
 
-	resp, err := c.Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753", srv.URL))
+	resp, err := c.Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&variables=max_temp", srv.URL))
 	if err != nil {
 		t.Errorf("Request to internal test server without response, got %+v.", err)
 		t.Fatal("This is bad. Really bad. Technically it should never happen.")
@@ -70,57 +87,22 @@ func TestGetWeatherEndpoint_ReturnsResult(t *testing.T) {
 		t.Fatal("Can't verify response integrity, aborting!")
 	}
 
-	var result testResult
-	if err := json.Unmarshal(data, &result); err != nil {
+	var response testResponse
+	if err := json.Unmarshal(data, &response); err != nil {
 		t.Errorf("Unable to unmarshal API response data, got %+v", err)
 		t.Fatal("Can't verify response integrity, aborting!")
 	}
+	result := testResult{
+		OpenMeteo:  response.Providers.OpenMeteo.Forecast,
+		WeatherAPI: response.Providers.WeatherAPI.Forecast,
+	}
 
+	// OpenMeteo is asked for local days, WeatherAPI answers in the local time of
+	// the location, which is UTC at the fake.
+	now := time.Now()
 	expected := testResult{
-		WeatherAPI1: types.FiveDayForecast{
-			Day1: types.Forecast{
-				Date:    "2024-11-05",
-				MaxTemp: 21.9,
-			},
-			Day2: types.Forecast{
-				Date:    "2024-11-06",
-				MaxTemp: 21,
-			},
-			Day3: types.Forecast{
-				Date:    "2024-11-07",
-				MaxTemp: 22.6,
-			},
-			Day4: types.Forecast{
-				Date:    "2024-11-08",
-				MaxTemp: 18.3,
-			},
-			Day5: types.Forecast{
-				Date:    "2024-11-09",
-				MaxTemp: 18.2,
-			},
-		},
-		WeatherAPI2: types.FiveDayForecast{
-			Day1: types.Forecast{
-				Date:    "2024-11-05",
-				MaxTemp: 19.8,
-			},
-			Day2: types.Forecast{
-				Date:    "2024-11-06",
-				MaxTemp: 22.1,
-			},
-			Day3: types.Forecast{
-				Date:    "2024-11-07",
-				MaxTemp: 21,
-			},
-			Day4: types.Forecast{
-				Date:    "2024-11-08",
-				MaxTemp: 19,
-			},
-			Day5: types.Forecast{
-				Date:    "2024-11-09",
-				MaxTemp: 19,
-			},
-		},
+		OpenMeteo:  forecastFrom(now, 21.9, 21, 22.6, 18.3, 18.2),
+		WeatherAPI: forecastFrom(now.UTC(), 19.8, 22.1, 21, 19, 19),
 	}
 
 	if !cmp.Equal(expected, result) {
@@ -129,15 +111,15 @@ func TestGetWeatherEndpoint_ReturnsResult(t *testing.T) {
 	}
 }
 
-// apiKey is a helper function to get the API key from the envvars.
-// The github.com/ardanlabs/conf/v3 package doesn't help here.
-func apiKey() (string, error) {
-	res := os.Getenv("WEATHER_API_KEY")
-	var empty string
-
-	if res == empty {
-		return empty, errors.New("envvar WAPI_KEY has empty value")
+// forecastFrom returns the forecast of the maximum temperatures tt, one per day
+// from the day of t on.
+func forecastFrom(t time.Time, tt ...float32) types.DailyForecast {
+	res := make(types.DailyForecast, 0, len(tt))
+	for i, temp := range tt {
+		res = append(res, types.Forecast{
+			Date:    t.AddDate(0, 0, i).Format(time.DateOnly),
+			MaxTemp: temp,
+		})
 	}
-
-	return res, nil
+	return res
 }
@@ -0,0 +1,363 @@
+/*
+Package aggregatortest checks that implementations of api.Aggregator play by
+the rules the server relies on, so every provider gets the same guarantees.
+
+A provider test hands the suite a constructor and an upstream that answers with
+valid forecasts, usually one of the servers of package fake:
+
+	func TestConformance(t *testing.T) {
+		srv := fake.NewOpenMeteo(t)
+		aggregatortest.Run(t, aggregatortest.Config{
+			New: func(t *testing.T, client *http.Client) api.Aggregator {
+				return openmeteo.DebuggingCaller(srv.BaseURL(), client, time.Now)
+			},
+			Upstream: srv.Client().Transport,
+		})
+	}
+
+The suite checks the order of the days, the horizon, the ranges of the values,
+cancellation, the classification of failed upstream calls and whether
+concurrent calls are safe. Aggregators that implement api.HourlyAggregator
+get their hours checked, too. Run it with -race for the latter to count.
+
+Failures special to a provider, like the messages of its API, are checked with
+RunErrorKinds, answering the calls with canned responses:
+
+	aggregatortest.RunErrorKinds(t, cfg, []aggregatortest.ErrorCase{{
+		Name:   "invalid location",
+		Status: http.StatusBadRequest,
+		Body:   `{"error":true,"reason":"Latitude must be in range of -90 to 90°."}`,
+		Kind:   aggregatortest.KindInvalidLocation,
+	}})
+
+Aggregators of other modules run the suite the same way. They can't import the
+internal packages of this one, so the types they implement and return, like
+Aggregator, Query or ProviderError, are aliased in this package.
+*/
+package aggregatortest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// Config describes the aggregator under test.
+type Config struct {
+	// New returns the aggregator under test, which sends all of its requests
+	// with the client. The client doesn't retry, so failures surface at once.
+	New func(t *testing.T, client *http.Client) api.Aggregator
+	// Upstream answers the requests of the aggregator with valid forecasts for
+	// any horizon up to its MaxForecastDays.
+	Upstream http.RoundTripper
+	// Lat and Lon are the location to ask for, defaulting to Ribeira, Galicia.
+	Lat, Lon float64
+	// Secret is the API key New hands the aggregator, if any. It must not
+	// show up in the errors.
+	Secret string
+}
+
+// Run runs the whole suite as subtests of t.
+func Run(t *testing.T, cfg Config) {
+	t.Helper()
+	cfg = defaults(cfg)
+
+	t.Run("DateOrder", func(t *testing.T) { testDateOrder(t, cfg) })
+	t.Run("Horizon", func(t *testing.T) { testHorizon(t, cfg) })
+	t.Run("UnitRanges", func(t *testing.T) { testUnitRanges(t, cfg) })
+	t.Run("Cancellation", func(t *testing.T) { testCancellation(t, cfg) })
+	t.Run("UpstreamStatus", func(t *testing.T) { RunErrorKinds(t, cfg, upstreamStatus) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, cfg) })
+	t.Run("HourlyOrder", func(t *testing.T) { testHourlyOrder(t, cfg) })
+}
+
+// defaults fills in the location cfg leaves out.
+func defaults(cfg Config) Config {
+	if cfg.Lat == 0 && cfg.Lon == 0 {
+		cfg.Lat, cfg.Lon = 42.6493934, -8.8201753
+	}
+	return cfg
+}
+
+// upstream returns the aggregator under test talking to the upstream of cfg.
+func upstream(t *testing.T, cfg Config) api.Aggregator {
+	t.Helper()
+	return cfg.New(t, &http.Client{Transport: cfg.Upstream})
+}
+
+// query returns the query of days days for all variables.
+func query(cfg Config, days int) types.Query {
+	return types.Query{Lat: cfg.Lat, Lon: cfg.Lon, Days: days}
+}
+
+// testDateOrder checks the days follow each other without gaps, starting with
+// the first one.
+func testDateOrder(t *testing.T, cfg Config) {
+	sut := upstream(t, cfg)
+	days := min(5, sut.MaxForecastDays())
+
+	got, err := sut.AggregateWeather(context.Background(), query(cfg, days))
+	if err != nil {
+		t.Fatalf("Aggregate %d days: %+v", days, err)
+	}
+	if len(got) != days {
+		t.Fatalf("Forecast must hold %d days, got %d", days, len(got))
+	}
+
+	var prev time.Time
+	for i, f := range got {
+		date, err := time.Parse(time.DateOnly, f.Date)
+		if err != nil {
+			t.Fatalf("Day %d must be an ISO 8601 date, got %#v", i, f.Date)
+		}
+		if i > 0 && !date.Equal(prev.AddDate(0, 0, 1)) {
+			t.Errorf("Day %d must follow %s, got %s", i, prev.Format(time.DateOnly), f.Date)
+		}
+		prev = date
+	}
+}
+
+// testHorizon checks the aggregator serves its whole horizon and refuses to go
+// beyond it with a *aggregator.HorizonError.
+func testHorizon(t *testing.T, cfg Config) {
+	sut := upstream(t, cfg)
+	maxDays := sut.MaxForecastDays()
+	if maxDays < 1 {
+		t.Fatalf("MaxForecastDays must be positive, got %d", maxDays)
+	}
+
+	got, err := sut.AggregateWeather(context.Background(), query(cfg, maxDays))
+	if err != nil {
+		t.Fatalf("Aggregate the whole horizon of %d days: %+v", maxDays, err)
+	}
+	if len(got) != maxDays {
+		t.Errorf("Forecast must hold %d days, got %d", maxDays, len(got))
+	}
+
+	_, err = sut.AggregateWeather(context.Background(), query(cfg, maxDays+1))
+	var hErr *aggregator.HorizonError
+	if !errors.As(err, &hErr) {
+		t.Fatalf("Beyond the horizon must return *aggregator.HorizonError, got %+v", err)
+	}
+	if hErr.Max != maxDays || hErr.Requested != maxDays+1 {
+		t.Errorf("Horizon error must tell %d of %d days, got %+v", maxDays+1, maxDays, hErr)
+	}
+}
+
+// valueRange is the range of plausible values of a variable in the units of
+// types.Forecast.
+type valueRange struct {
+	name     string
+	value    func(types.Forecast) float32
+	min, max float32
+}
+
+var valueRanges = []valueRange{
+	{"max_temp", func(f types.Forecast) float32 { return f.MaxTemp }, -90, 60},
+	{"min_temp", func(f types.Forecast) float32 { return f.MinTemp }, -90, 60},
+	{"precipitation_sum", func(f types.Forecast) float32 { return f.PrecipitationSum }, 0, 2000},
+	{"precipitation_probability", func(f types.Forecast) float32 { return f.PrecipitationProbability }, 0, 100},
+	{"max_wind_speed", func(f types.Forecast) float32 { return f.MaxWindSpeed }, 0, 500},
+	{"max_wind_gust", func(f types.Forecast) float32 { return f.MaxWindGust }, 0, 500},
+	{"wind_direction", func(f types.Forecast) float32 { return f.WindDirection }, 0, 360},
+	{"relative_humidity", func(f types.Forecast) float32 { return f.RelativeHumidity }, 0, 100},
+	{"uv_index", func(f types.Forecast) float32 { return f.UVIndex }, 0, 20},
+}
+
+// testUnitRanges checks the values are within physical limits, which catches
+// values left in other units, like Fahrenheit or m/s.
+func testUnitRanges(t *testing.T, cfg Config) {
+	sut := upstream(t, cfg)
+	days := min(5, sut.MaxForecastDays())
+
+	got, err := sut.AggregateWeather(context.Background(), query(cfg, days))
+	if err != nil {
+		t.Fatalf("Aggregate %d days: %+v", days, err)
+	}
+
+	for _, f := range got {
+		for _, r := range valueRanges {
+			if v := r.value(f); v < r.min || v > r.max {
+				t.Errorf("%s on %s must be within %g and %g, got %g", r.name, f.Date, r.min, r.max, v)
+			}
+		}
+		if f.MinTemp > f.MaxTemp {
+			t.Errorf("min_temp on %s must not exceed max_temp, got %g > %g", f.Date, f.MinTemp, f.MaxTemp)
+		}
+		for name, v := range map[string]string{"sunrise": f.Sunrise, "sunset": f.Sunset} {
+			if _, err := time.Parse("2006-01-02T15:04", v); v != "" && err != nil {
+				t.Errorf("%s on %s must be a local ISO 8601 time, got %#v", name, f.Date, v)
+			}
+		}
+	}
+}
+
+// testCancellation checks the aggregator reports a *aggregator.CanceledError,
+// both for requests cancelled before and while it calls the upstream, and that
+// it stops waiting for the upstream at once.
+func testCancellation(t *testing.T, cfg Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := upstream(t, cfg).AggregateWeather(ctx, query(cfg, 1))
+	var cErr *aggregator.CanceledError
+	if !errors.As(err, &cErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled context must return *aggregator.CanceledError, got %+v", err)
+	}
+
+	hanging := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		<-r.Context().Done()
+		return nil, r.Context().Err()
+	})
+	sut := cfg.New(t, &http.Client{Transport: hanging})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = sut.AggregateWeather(ctx, query(cfg, 1))
+	if !errors.As(err, &cErr) || !cErr.Timeout() {
+		t.Errorf("Timed out context must return *aggregator.CanceledError with timeout, got %+v", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Timed out call must return at once, took %s", took)
+	}
+}
+
+// upstreamStatus are the status codes of failed upstream calls and the kinds
+// the server maps to its own status codes, plus a body that isn't JSON.
+var upstreamStatus = []ErrorCase{
+	{Name: "401", Status: http.StatusUnauthorized, Kind: aggregator.KindAuth},
+	{Name: "403", Status: http.StatusForbidden, Kind: aggregator.KindAuth},
+	{Name: "429", Status: http.StatusTooManyRequests, Kind: aggregator.KindRateLimited},
+	{Name: "500", Status: http.StatusInternalServerError, Kind: aggregator.KindUnavailable},
+	{Name: "502", Status: http.StatusBadGateway, Kind: aggregator.KindUnavailable},
+	{Name: "503", Status: http.StatusServiceUnavailable, Kind: aggregator.KindUnavailable},
+	{Name: "504", Status: http.StatusGatewayTimeout, Kind: aggregator.KindTimeout},
+	{Name: "malformed", Status: http.StatusOK, Body: `{"`, Kind: aggregator.KindDecode},
+}
+
+// ErrorCase is a response of the upstream and the kind of
+// *aggregator.ProviderError the aggregator must make of it.
+type ErrorCase struct {
+	Name   string
+	Status int
+	// Header defaults to JSON, Body to the text of the status code.
+	Header     http.Header
+	Body       string
+	Kind       Kind
+	RetryAfter time.Duration
+}
+
+// RunErrorKinds answers the calls of the aggregator of cfg with each of the
+// cases, as subtests of t. The upstream of cfg isn't needed.
+// Only the cases special to the provider need to be listed, the usual status
+// codes are part of Run already.
+func RunErrorKinds(t *testing.T, cfg Config, cases []ErrorCase) {
+	t.Helper()
+	cfg = defaults(cfg)
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			body := tc.Body
+			if body == "" {
+				body = http.StatusText(tc.Status)
+			}
+			sut := cfg.New(t, Respond(tc.Status, tc.Header, body))
+			days := min(3, sut.MaxForecastDays())
+
+			_, err := sut.AggregateWeather(context.Background(), query(cfg, days))
+			var pErr *aggregator.ProviderError
+			if !errors.As(err, &pErr) {
+				t.Fatalf("Upstream status %d must return *aggregator.ProviderError, got %+v", tc.Status, err)
+			}
+			if pErr.Provider == "" {
+				t.Errorf("Provider error must name the provider, got %+v", pErr)
+			}
+			if pErr.Kind != tc.Kind {
+				t.Errorf("Upstream status %d must be kind %#v, got %#v", tc.Status, tc.Kind, pErr.Kind)
+			}
+			if pErr.RetryAfter != tc.RetryAfter {
+				t.Errorf("Upstream status %d must retry after %s, got %s", tc.Status, tc.RetryAfter, pErr.RetryAfter)
+			}
+			if cfg.Secret != "" && strings.Contains(err.Error(), cfg.Secret) {
+				t.Errorf("Error must not leak the API key, got %+v", err)
+			}
+		})
+	}
+}
+
+// testConcurrency checks concurrent calls of a single aggregator get the same
+// forecast, as the server shares it between all requests.
+func testConcurrency(t *testing.T, cfg Config) {
+	sut := upstream(t, cfg)
+	days := min(3, sut.MaxForecastDays())
+
+	want, err := sut.AggregateWeather(context.Background(), query(cfg, days))
+	if err != nil {
+		t.Fatalf("Aggregate %d days: %+v", days, err)
+	}
+
+	const calls = 8
+	results := make([]types.DailyForecast, calls)
+	errs := make([]error, calls)
+
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = sut.AggregateWeather(context.Background(), query(cfg, days))
+		}()
+	}
+	wg.Wait()
+
+	for i := range calls {
+		if errs[i] != nil {
+			t.Errorf("Concurrent call %d failed: %+v", i, errs[i])
+			continue
+		}
+		if !cmp.Equal(want, results[i]) {
+			t.Errorf("Concurrent call %d differs: %s", i, cmp.Diff(want, results[i]))
+		}
+	}
+}
+
+// testHourlyOrder checks the hours of an api.HourlyAggregator follow each other
+// without gaps.
+func testHourlyOrder(t *testing.T, cfg Config) {
+	sut, ok := upstream(t, cfg).(api.HourlyAggregator)
+	if !ok {
+		t.Skip("Aggregator has no hourly forecasts")
+	}
+
+	const hours = 30
+	got, err := sut.AggregateHourly(context.Background(), types.Query{Lat: cfg.Lat, Lon: cfg.Lon, Hours: hours})
+	if err != nil {
+		t.Fatalf("Aggregate %d hours: %+v", hours, err)
+	}
+	if len(got) != hours {
+		t.Fatalf("Forecast must hold %d hours, got %d", hours, len(got))
+	}
+
+	var prev time.Time
+	for i, h := range got {
+		hour, err := time.Parse("2006-01-02T15:04", h.Time)
+		if err != nil {
+			t.Fatalf("Hour %d must be a local ISO 8601 time, got %#v", i, h.Time)
+		}
+		if i > 0 && !hour.Equal(prev.Add(time.Hour)) {
+			t.Errorf("Hour %d must follow %s, got %s", i, prev.Format("2006-01-02T15:04"), h.Time)
+		}
+		prev = hour
+	}
+}
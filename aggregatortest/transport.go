@@ -0,0 +1,31 @@
+package aggregatortest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RoundTripFunc turns a function into a http.RoundTripper, so tests answer the
+// requests of an aggregator without touching the network.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Respond returns a client that answers every request with the status code,
+// the header and the body. A nil header means JSON.
+func Respond(status int, header http.Header, body string) *http.Client {
+	if header == nil {
+		header = http.Header{"Content-Type": {"application/json"}}
+	}
+	return &http.Client{Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Header:     header.Clone(),
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+}
@@ -0,0 +1,38 @@
+package aggregatortest
+
+import (
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// Aggregators outside of this module can't import the internal packages, so
+// the types they implement and return are available here as well.
+type (
+	Aggregator         = api.Aggregator
+	HourlyAggregator   = api.HourlyAggregator
+	VariableAggregator = api.VariableAggregator
+
+	Query          = types.Query
+	Variable       = types.Variable
+	Condition      = types.Condition
+	Forecast       = types.Forecast
+	DailyForecast  = types.DailyForecast
+	HourForecast   = types.HourForecast
+	HourlyForecast = types.HourlyForecast
+
+	HorizonError  = aggregator.HorizonError
+	ProviderError = aggregator.ProviderError
+	CanceledError = aggregator.CanceledError
+	Kind          = aggregator.Kind
+)
+
+// The kinds of failed upstream calls the suite expects in a ProviderError.
+const (
+	KindUnavailable     = aggregator.KindUnavailable
+	KindRateLimited     = aggregator.KindRateLimited
+	KindAuth            = aggregator.KindAuth
+	KindDecode          = aggregator.KindDecode
+	KindInvalidLocation = aggregator.KindInvalidLocation
+	KindTimeout         = aggregator.KindTimeout
+)
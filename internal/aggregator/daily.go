@@ -0,0 +1,111 @@
+package aggregator
+
+import (
+	"math"
+	"slices"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// MsToKmh converts wind speeds from m/s into km/h.
+const MsToKmh = 3.6
+
+// Wind is the wind at some time, its speed in any unit and the direction it
+// blows from in degrees.
+type Wind struct {
+	Speed     float32
+	Direction float32
+}
+
+// DominantDirection sums up the winds ww as vectors weighted by their speed
+// and returns the direction of the sum in whole degrees, from 0 up to 359.
+// This matches how OpenMeteo calculates its dominant wind direction, so
+// providers without one of their own agree with it.
+func DominantDirection(ww []Wind) float32 {
+	var x, y float64
+	for _, w := range ww {
+		rad := float64(w.Direction) * math.Pi / 180
+		x += float64(w.Speed) * math.Sin(rad)
+		y += float64(w.Speed) * math.Cos(rad)
+	}
+	deg := math.Round(math.Atan2(x, y) * 180 / math.Pi)
+	// Just west of north rounds up to a full circle, which is north again.
+	return float32(math.Mod(deg+360, 360))
+}
+
+// severities orders the canonical conditions from the mildest to the worst.
+// Precipitation beats clouds, frozen beats liquid and thunder beats all.
+var severities = []types.Condition{
+	types.ConditionClear,
+	types.ConditionPartlyCloudy,
+	types.ConditionCloudy,
+	types.ConditionOvercast,
+	types.ConditionFog,
+	types.ConditionLightDrizzle,
+	types.ConditionDrizzle,
+	types.ConditionLightRain,
+	types.ConditionRainShowers,
+	types.ConditionRain,
+	types.ConditionHeavyRain,
+	types.ConditionFreezingDrizzle,
+	types.ConditionFreezingRain,
+	types.ConditionSleet,
+	types.ConditionLightSnow,
+	types.ConditionSnowShowers,
+	types.ConditionSnow,
+	types.ConditionHeavySnow,
+	types.ConditionThunderstorm,
+	types.ConditionThunderstormHail,
+}
+
+// WorstCondition returns the worst of the conditions cc, which stands for the
+// whole day, like OpenMeteo's daily weather code does. Without any known
+// condition it's unknown.
+func WorstCondition(cc []types.Condition) types.Condition {
+	res, worst := types.ConditionUnknown, -1
+	for _, c := range cc {
+		if rank := slices.Index(severities, c); rank > worst {
+			res, worst = c, rank
+		}
+	}
+	return res
+}
+
+// Filter zeroes the values the query didn't ask for.
+func Filter(f types.Forecast, q types.Query) types.Forecast {
+	res := types.Forecast{Date: f.Date}
+	if q.Wants(types.VarMaxTemp) {
+		res.MaxTemp = f.MaxTemp
+	}
+	if q.Wants(types.VarMinTemp) {
+		res.MinTemp = f.MinTemp
+	}
+	if q.Wants(types.VarPrecipitationSum) {
+		res.PrecipitationSum = f.PrecipitationSum
+	}
+	if q.Wants(types.VarPrecipitationProbability) {
+		res.PrecipitationProbability = f.PrecipitationProbability
+	}
+	if q.Wants(types.VarMaxWindSpeed) {
+		res.MaxWindSpeed = f.MaxWindSpeed
+	}
+	if q.Wants(types.VarMaxWindGust) {
+		res.MaxWindGust = f.MaxWindGust
+	}
+	if q.Wants(types.VarWindDirection) {
+		res.WindDirection = f.WindDirection
+	}
+	if q.Wants(types.VarRelativeHumidity) {
+		res.RelativeHumidity = f.RelativeHumidity
+	}
+	if q.Wants(types.VarSunrise) {
+		res.Sunrise = f.Sunrise
+	}
+	if q.Wants(types.VarSunset) {
+		res.Sunset = f.Sunset
+	}
+	if q.Wants(types.VarCondition) {
+		res.Condition = f.Condition
+	}
+	return res
+}
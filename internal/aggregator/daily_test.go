@@ -0,0 +1,78 @@
+package aggregator_test
+
+import (
+	"testing"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+type dominantDirectionTestValues struct {
+	winds []aggregator.Wind
+	want  float32
+}
+
+func TestDominantDirection(t *testing.T) {
+	rr := []dominantDirectionTestValues{
+		{winds: nil, want: 0},
+		{winds: []aggregator.Wind{{Speed: 10, Direction: 270}}, want: 270},
+		{winds: []aggregator.Wind{{Speed: 10, Direction: 0}, {Speed: 10, Direction: 90}}, want: 45},
+		{winds: []aggregator.Wind{{Speed: 10, Direction: 350}, {Speed: 10, Direction: 10}}, want: 0},
+		{winds: []aggregator.Wind{{Speed: 30, Direction: 180}, {Speed: 10, Direction: 0}}, want: 180},
+		{winds: []aggregator.Wind{{Speed: 10, Direction: 180}, {Speed: 10, Direction: 270}}, want: 225},
+	}
+
+	for _, r := range rr {
+		if got := aggregator.DominantDirection(r.winds); got != r.want {
+			t.Errorf("Winds %+v must be from %v°, got %v°", r.winds, r.want, got)
+		}
+	}
+}
+
+type worstConditionTestValues struct {
+	conditions []types.Condition
+	want       types.Condition
+}
+
+func TestWorstCondition(t *testing.T) {
+	rr := []worstConditionTestValues{
+		{conditions: nil, want: types.ConditionUnknown},
+		{conditions: []types.Condition{types.ConditionUnknown}, want: types.ConditionUnknown},
+		{conditions: []types.Condition{types.ConditionUnknown, types.ConditionClear}, want: types.ConditionClear},
+		{conditions: []types.Condition{types.ConditionOvercast, types.ConditionClear}, want: types.ConditionOvercast},
+		{conditions: []types.Condition{types.ConditionLightRain, types.ConditionFog}, want: types.ConditionLightRain},
+		{conditions: []types.Condition{types.ConditionRain, types.ConditionLightSnow}, want: types.ConditionLightSnow},
+		{conditions: []types.Condition{types.ConditionHeavySnow, types.ConditionThunderstorm}, want: types.ConditionThunderstorm},
+	}
+
+	for _, r := range rr {
+		if got := aggregator.WorstCondition(r.conditions); got != r.want {
+			t.Errorf("Conditions %v must be %#v, got %#v", r.conditions, r.want, got)
+		}
+	}
+}
+
+// TestWorstCondition_RanksAll verifies every canonical condition beats unknown,
+// so no condition gets lost to the ranking.
+func TestWorstCondition_RanksAll(t *testing.T) {
+	for _, c := range types.AllConditions() {
+		if c.Code == types.ConditionUnknown {
+			continue
+		}
+		cc := []types.Condition{c.Code, types.ConditionUnknown}
+		if got := aggregator.WorstCondition(cc); got != c.Code {
+			t.Errorf("Condition %#v must be ranked, got %#v", c.Code, got)
+		}
+	}
+}
+
+// TestFilter verifies only the date and the asked for values are kept.
+func TestFilter(t *testing.T) {
+	f := types.Forecast{Date: "2024-11-05", MaxTemp: 19.8, MinTemp: 12.1, Sunrise: "2024-11-05T08:16"}
+	q := types.Query{Variables: []types.Variable{types.VarMinTemp}}
+
+	want := types.Forecast{Date: "2024-11-05", MinTemp: 12.1}
+	if got := aggregator.Filter(f, q); got != want {
+		t.Errorf("Filtered forecast must be %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Package aggregator holds the pieces the provider packages below it share, so
+every weather provider reports its failures in the same way.
+*/
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CanceledError reports that a provider stopped its upstream calls because the
+// incoming request got cancelled or ran past its deadline.
+// It unwraps to the context error, so errors.Is(err, context.Canceled) works.
+type CanceledError struct {
+	Provider string
+	Err      error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("%s: request cancelled: %v", e.Provider, e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout tells if the cancellation was caused by an exceeded deadline instead
+// of the caller walking away.
+func (e *CanceledError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// Canceled wraps the context error into a CanceledError for the provider.
+// It returns nil if the context is still alive, so callers can simply check
+// `if err := aggregator.Canceled(ctx, "name"); err != nil` after failures.
+func Canceled(ctx context.Context, provider string) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return &CanceledError{Provider: provider, Err: ctx.Err()}
+}
+
+// HorizonError reports that a provider cannot look as far ahead as the client
+// asked for. Unit is either "days" or "hours".
+type HorizonError struct {
+	Provider  string
+	Max       int
+	Requested int
+	Unit      string
+}
+
+func (e *HorizonError) Error() string {
+	return fmt.Sprintf(
+		"%s supports at most %d forecast %s, requested %d",
+		e.Provider, e.Max, e.Unit, e.Requested,
+	)
+}
+
+// Kind classifies why a provider failed, so the API can answer with a fitting
+// status code and operators can tell a bad key apart from an outage.
+type Kind string
+
+const (
+	// KindUnavailable means the upstream API is down or unreachable.
+	KindUnavailable Kind = "unavailable"
+	// KindRateLimited means the upstream API refuses more calls for now.
+	KindRateLimited Kind = "rate_limited"
+	// KindAuth means the upstream API rejected the configured API key.
+	KindAuth Kind = "auth"
+	// KindDecode means the response doesn't match what the provider expects.
+	KindDecode Kind = "decode"
+	// KindInvalidLocation means the upstream API doesn't know the location.
+	KindInvalidLocation Kind = "invalid_location"
+	// KindTimeout means the upstream API took too long to answer.
+	KindTimeout Kind = "timeout"
+)
+
+// ProviderError reports that a provider failed to deliver its forecast, like
+// an unreachable API or a response that doesn't add up.
+// Kind is empty for failures that don't fit any kind. RetryAfter tells how long
+// the upstream API asked to wait before calling it again, if it did.
+// It unwraps to the underlying error.
+type ProviderError struct {
+	Provider   string
+	Kind       Kind
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.Kind == "" {
+		return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Provider, e.Kind, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Failed wraps the error err of the provider into a typed error. It prefers a
+// CanceledError if the context is done, as that most likely caused err.
+// Errors that are typed already are returned as they are, others count as
+// unavailable upstream API or as timeout.
+func Failed(ctx context.Context, provider string, err error) error {
+	if cErr := Canceled(ctx, provider); cErr != nil {
+		return cErr
+	}
+
+	var pErr *ProviderError
+	if errors.As(err, &pErr) {
+		return err
+	}
+
+	kind := KindUnavailable
+	var nErr net.Error
+	if errors.As(err, &nErr) && nErr.Timeout() {
+		kind = KindTimeout
+	}
+	return &ProviderError{Provider: provider, Kind: kind, Err: err}
+}
+
+// StatusKind classifies an unexpected HTTP status code of an upstream API.
+// It returns an empty Kind for status codes the provider has to judge itself.
+func StatusKind(code int) Kind {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return KindAuth
+	case code == http.StatusTooManyRequests:
+		return KindRateLimited
+	case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout:
+		return KindTimeout
+	case code >= 500:
+		return KindUnavailable
+	default:
+		return ""
+	}
+}
+
+// RetryAfter reads the Retry-After header h, given either in seconds or as
+// HTTP date. It returns zero if the header is missing or unreadable.
+func RetryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// ErrQuotaExhausted is wrapped by providers that don't call their upstream API
+// anymore, as the budget of their API key is used up.
+var ErrQuotaExhausted = errors.New("quota budget exhausted")
+
+// ErrNoApiKeyProvided is returned by the constructors of providers that can't
+// work without an API key.
+var ErrNoApiKeyProvided = errors.New("API key missing")
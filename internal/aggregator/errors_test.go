@@ -0,0 +1,82 @@
+package aggregator_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+)
+
+type statusKindTestValues struct {
+	code int
+	want aggregator.Kind
+}
+
+func TestStatusKind(t *testing.T) {
+	rr := []statusKindTestValues{
+		{code: http.StatusBadRequest, want: ""},
+		{code: http.StatusUnauthorized, want: aggregator.KindAuth},
+		{code: http.StatusForbidden, want: aggregator.KindAuth},
+		{code: http.StatusTooManyRequests, want: aggregator.KindRateLimited},
+		{code: http.StatusInternalServerError, want: aggregator.KindUnavailable},
+		{code: http.StatusBadGateway, want: aggregator.KindUnavailable},
+		{code: http.StatusServiceUnavailable, want: aggregator.KindUnavailable},
+		{code: http.StatusGatewayTimeout, want: aggregator.KindTimeout},
+	}
+
+	for _, r := range rr {
+		if got := aggregator.StatusKind(r.code); got != r.want {
+			t.Errorf("Status %d must be kind %#v, got %#v", r.code, r.want, got)
+		}
+	}
+}
+
+type retryAfterTestValues struct {
+	header string
+	want   time.Duration
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 11, 5, 12, 0, 0, 0, time.UTC)
+	rr := []retryAfterTestValues{
+		{header: "", want: 0},
+		{header: "120", want: 2 * time.Minute},
+		{header: "-5", want: 0},
+		{header: "Tue, 05 Nov 2024 12:00:30 GMT", want: 30 * time.Second},
+		{header: "Tue, 05 Nov 2024 11:00:00 GMT", want: 0},
+		{header: "soon", want: 0},
+	}
+
+	for _, r := range rr {
+		h := http.Header{}
+		if r.header != "" {
+			h.Set("Retry-After", r.header)
+		}
+		if got := aggregator.RetryAfter(h, now); got != r.want {
+			t.Errorf("Retry-After %#v must be %s, got %s", r.header, r.want, got)
+		}
+	}
+}
+
+func TestFailed_PrefersCancellationAndKeepsTypedErrors(t *testing.T) {
+	typed := &aggregator.ProviderError{Provider: "stub", Kind: aggregator.KindAuth, Err: errors.New("bad key")}
+	if got := aggregator.Failed(context.Background(), "stub", typed); got != typed {
+		t.Errorf("Typed errors must be returned as they are, got %+v", got)
+	}
+
+	var pErr *aggregator.ProviderError
+	err := aggregator.Failed(context.Background(), "stub", errors.New("connection refused"))
+	if !errors.As(err, &pErr) || pErr.Kind != aggregator.KindUnavailable {
+		t.Errorf("Untyped errors must count as unavailable, got %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var cErr *aggregator.CanceledError
+	if err := aggregator.Failed(ctx, "stub", typed); !errors.As(err, &cErr) {
+		t.Errorf("Done contexts must return *aggregator.CanceledError, got %+v", err)
+	}
+}
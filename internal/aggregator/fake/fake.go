@@ -0,0 +1,256 @@
+/*
+Package fake runs local stand-ins for the upstream weather APIs, so tests
+neither need the internet nor API keys and don't break every single day.
+
+The servers answer with made-up but deterministic forecasts built from a list
+of Days, starting at the requested date. Responses can be scripted one by one to
+test failures like error statuses, slow responses or malformed JSON:
+
+	srv := fake.NewOpenMeteo(t)
+	srv.Enqueue(fake.Response{Status: http.StatusBadGateway})
+	caller := openmeteo.DebuggingCaller(srv.BaseURL(), srv.Client(), time.Now)
+*/
+package fake
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Day holds the made-up weather of a single day in the units of the domain
+// types, so °C, km/h and mm. Sunrise and Sunset are local times like "07:45".
+// The condition codes are the ones of the respective provider.
+type Day struct {
+	MaxTemp                  float32
+	MinTemp                  float32
+	PrecipitationSum         float32
+	PrecipitationProbability float32
+	MaxWindSpeed             float32
+	MaxWindGust              float32
+	WindDirection            float32
+	RelativeHumidity         float32
+	UVIndex                  float32
+	CloudCover               float32
+	Sunrise                  string
+	Sunset                   string
+	WMOCode                  int
+	WeatherAPICode           int
+}
+
+// DefaultDays is the weather the servers start with, a mild and partly rainy
+// autumn week in Galicia. Longer horizons repeat it.
+var DefaultDays = []Day{
+	{MaxTemp: 21.9, MinTemp: 13.1, PrecipitationSum: 0, PrecipitationProbability: 5, MaxWindSpeed: 12.2, MaxWindGust: 25.6, WindDirection: 90, RelativeHumidity: 71, UVIndex: 3.1, CloudCover: 10, Sunrise: "08:21", Sunset: "18:27", WMOCode: 0, WeatherAPICode: 1000},
+	{MaxTemp: 21, MinTemp: 12.4, PrecipitationSum: 0, PrecipitationProbability: 10, MaxWindSpeed: 10.8, MaxWindGust: 22.3, WindDirection: 110, RelativeHumidity: 74, UVIndex: 2.9, CloudCover: 35, Sunrise: "08:22", Sunset: "18:26", WMOCode: 2, WeatherAPICode: 1003},
+	{MaxTemp: 22.6, MinTemp: 14, PrecipitationSum: 0.4, PrecipitationProbability: 30, MaxWindSpeed: 14.4, MaxWindGust: 29.5, WindDirection: 200, RelativeHumidity: 80, UVIndex: 2.4, CloudCover: 80, Sunrise: "08:23", Sunset: "18:25", WMOCode: 51, WeatherAPICode: 1153},
+	{MaxTemp: 18.3, MinTemp: 12.9, PrecipitationSum: 6.2, PrecipitationProbability: 85, MaxWindSpeed: 22.7, MaxWindGust: 46.1, WindDirection: 240, RelativeHumidity: 91, UVIndex: 1.2, CloudCover: 100, Sunrise: "08:25", Sunset: "18:24", WMOCode: 63, WeatherAPICode: 1189},
+	{MaxTemp: 18.2, MinTemp: 11.7, PrecipitationSum: 1.8, PrecipitationProbability: 60, MaxWindSpeed: 18.5, MaxWindGust: 37.8, WindDirection: 270, RelativeHumidity: 86, UVIndex: 1.8, CloudCover: 70, Sunrise: "08:26", Sunset: "18:22", WMOCode: 80, WeatherAPICode: 1240},
+}
+
+// hour holds the made-up weather of a single hour, derived from its day.
+// The temperature rises from the minimum at midnight to the maximum at 2 PM,
+// rain falls evenly and the wind blows at its daily maximum all day long, so
+// the daily values summed up from the hours match the Day.
+type hour struct {
+	Time                     time.Time
+	Day                      Day
+	Temp                     float32
+	Precipitation            float32
+	PrecipitationProbability float32
+	WindSpeed                float32
+	WindGust                 float32
+	WindDirection            float32
+	CloudCover               float32
+}
+
+// Response scripts a single answer of a server. Zero Status means 200 OK.
+// A Body replaces the forecast, like malformed JSON or an error message.
+// Delay holds the answer back, unless the client gives up before.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   string
+	Delay  time.Duration
+}
+
+// Server is a running stand-in for an upstream API. It embeds the
+// httptest.Server, so its URL and Client are at hand.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	days     []Day
+	clock    func() time.Time
+	script   []Response
+	requests []*http.Request
+	forecast func(s *Server, h http.Header, r *http.Request) (int, any)
+}
+
+// newServer starts a server that answers with the forecast function and shuts
+// it down once the test is over.
+func newServer(tb testing.TB, forecast func(s *Server, h http.Header, r *http.Request) (int, any)) *Server {
+	tb.Helper()
+
+	s := &Server{
+		days:     DefaultDays,
+		clock:    time.Now,
+		forecast: forecast,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	tb.Cleanup(s.Close)
+
+	return s
+}
+
+// BaseURL returns the URL to hand to the callers as base URL.
+func (s *Server) BaseURL() *url.URL {
+	res, err := url.Parse(s.URL)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// SetDays replaces the weather the server answers with.
+func (s *Server) SetDays(dd ...Day) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.days = dd
+}
+
+// SetClock replaces the clock that tells the server what today is, which is
+// where forecasts start that don't ask for a date.
+func (s *Server) SetClock(clock func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clock = clock
+}
+
+// Enqueue scripts the next answers. Each one is used for a single request in
+// order, afterwards the server answers with forecasts again.
+func (s *Server) Enqueue(rr ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.script = append(s.script, rr...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]*http.Request, len(s.requests))
+	copy(res, s.requests)
+	return res
+}
+
+// day returns the weather of the i-th day of a forecast.
+func (s *Server) day(i int) Day {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.days[i%len(s.days)]
+}
+
+// today returns the current time of the server's clock.
+func (s *Server) today() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.clock().UTC()
+}
+
+// hourAt returns the weather of the hour at the time t, on the day of the
+// forecast that t falls in.
+func (s *Server) hourAt(t time.Time) hour {
+	y, m, d := s.today().Date()
+	first := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	day := s.day(int(t.Sub(first).Hours()) / 24)
+
+	warming := 1 - math.Abs(float64(t.Hour())-14)/14
+	return hour{
+		Time:                     t,
+		Day:                      day,
+		Temp:                     day.MinTemp + (day.MaxTemp-day.MinTemp)*float32(warming),
+		Precipitation:            day.PrecipitationSum / 24,
+		PrecipitationProbability: day.PrecipitationProbability,
+		WindSpeed:                day.MaxWindSpeed,
+		WindGust:                 day.MaxWindGust,
+		WindDirection:            day.WindDirection,
+		CloudCover:               day.CloudCover,
+	}
+}
+
+// hours returns the weather of n hours from the current hour on.
+func (s *Server) hours(n int) []hour {
+	start := s.today().Truncate(time.Hour)
+	res := make([]hour, 0, n)
+	for i := range n {
+		res = append(res, s.hourAt(start.Add(time.Duration(i)*time.Hour)))
+	}
+	return res
+}
+
+// next records the request and pops the next scripted answer, if there is one.
+func (s *Server) next(r *http.Request) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Clone(r.Context()))
+	if len(s.script) == 0 {
+		return Response{}, false
+	}
+	res := s.script[0]
+	s.script = s.script[1:]
+	return res, true
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	scripted, ok := s.next(r)
+
+	if scripted.Delay > 0 {
+		select {
+		case <-time.After(scripted.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for k, vv := range scripted.Header {
+		w.Header()[k] = vv
+	}
+
+	if ok && scripted.Body != "" {
+		w.WriteHeader(cmp.Or(scripted.Status, http.StatusOK))
+		w.Write([]byte(scripted.Body))
+		return
+	}
+	if ok && scripted.Status != 0 && scripted.Status != http.StatusOK {
+		http.Error(w, http.StatusText(scripted.Status), scripted.Status)
+		return
+	}
+
+	status, body := s.forecast(s, w.Header(), r)
+	writeJSON(w, status, body)
+}
+
+// writeJSON answers with the status and the JSON of v, if there is one.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	if v == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
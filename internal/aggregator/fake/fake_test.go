@@ -0,0 +1,81 @@
+package fake_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/fake"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/openmeteo"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/weatherapi"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// TestHourly_ProvidersAgree verifies both fakes serve the same hours for the
+// same days, even though their APIs slice them differently.
+func TestHourly_ProvidersAgree(t *testing.T) {
+	now := func() time.Time {
+		return time.Date(2024, 11, 5, 21, 30, 0, 0, time.UTC)
+	}
+	q := types.Query{Lat: 42.6493934, Lon: -8.8201753, Hours: 6}
+
+	om := fake.NewOpenMeteo(t)
+	om.SetClock(now)
+	omCaller := openmeteo.DebuggingCaller(om.BaseURL(), om.Client(), now)
+
+	wa := fake.NewWeatherAPI(t, "secret")
+	wa.SetClock(now)
+	waCaller, err := weatherapi.DebuggingCaller("secret", wa.BaseURL(), wa.Client(), now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+
+	want, err := omCaller.AggregateHourly(context.Background(), q)
+	if err != nil {
+		t.Fatalf("aggregate OpenMeteo: %+v", err)
+	}
+	got, err := waCaller.AggregateHourly(context.Background(), q)
+	if err != nil {
+		t.Fatalf("aggregate WeatherAPI: %+v", err)
+	}
+
+	if want[0].Time != "2024-11-05T21:00" || want[5].Time != "2024-11-06T02:00" {
+		t.Errorf("Hours must start with the current one, got %s to %s", want[0].Time, want[5].Time)
+	}
+	// The condition codes differ by design.
+	for i := range got {
+		got[i].Condition = want[i].Condition
+	}
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+// TestEnqueue verifies scripted responses are used once each and in order.
+func TestEnqueue(t *testing.T) {
+	srv := fake.NewOpenMeteo(t)
+	srv.Enqueue(
+		fake.Response{Status: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"1"}}},
+		fake.Response{Body: "{"},
+	)
+
+	want := []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusBadRequest}
+	for i, status := range want {
+		resp, err := srv.Client().Get(srv.URL + "/v1/forecast")
+		if err != nil {
+			t.Fatalf("Request %d without response, got %+v", i, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Errorf("Request %d must respond %d, got %d", i, status, resp.StatusCode)
+		}
+	}
+	if got := srv.Requests(); len(got) != len(want) {
+		t.Errorf("Server must record %d requests, got %d", len(want), len(got))
+	}
+}
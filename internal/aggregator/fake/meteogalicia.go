@@ -0,0 +1,141 @@
+package fake
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// NewMeteoGalicia starts a stand-in for the MeteoSIX numeric forecast endpoint
+// at /apiv4/getNumericForecastInfo, which only accepts the API key apikey and
+// locations in a box around Galicia. It serves 4 days from today on with the
+// hourly values of the requested variables, in UTC instead of Europe/Madrid.
+func NewMeteoGalicia(tb testing.TB, apikey string) *Server {
+	return newServer(tb, func(s *Server, h http.Header, r *http.Request) (int, any) {
+		return meteoGaliciaForecast(s, r, apikey)
+	})
+}
+
+// meteoGaliciaError is the body MeteoSIX answers failed requests with.
+func meteoGaliciaError(status, code int, message string) (int, any) {
+	return status, map[string]any{
+		"exception": map[string]any{"code": code, "message": message},
+	}
+}
+
+func meteoGaliciaForecast(s *Server, r *http.Request, apikey string) (int, any) {
+	if r.URL.Path != "/apiv4/getNumericForecastInfo" {
+		return meteoGaliciaError(http.StatusNotFound, 100, "Unknown service")
+	}
+
+	params := r.URL.Query()
+	if params.Get("API_KEY") != apikey {
+		return meteoGaliciaError(http.StatusUnauthorized, 209, "The API_KEY is not valid")
+	}
+
+	lon, lat, ok := strings.Cut(params.Get("coords"), ",")
+	if !ok {
+		return meteoGaliciaError(http.StatusBadRequest, 220, "The coords parameter is not valid")
+	}
+	if !within(lat, 40, 45) || !within(lon, -11.5, -4.5) {
+		return meteoGaliciaError(http.StatusBadRequest, 221, "The coordinates are outside the area covered")
+	}
+
+	y, m, d := s.today().Date()
+	first := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	days := make([]any, 0, 4)
+	for i := range 4 {
+		date := first.AddDate(0, 0, i)
+
+		hours := make([]hour, 0, 24)
+		for h := range 24 {
+			hours = append(hours, s.hourAt(date.Add(time.Duration(h)*time.Hour)))
+		}
+
+		var variables []any
+		for _, name := range strings.Split(params.Get("variables"), ",") {
+			if v, ok := meteoGaliciaVariable(name, hours); ok {
+				variables = append(variables, v)
+			}
+		}
+
+		days = append(days, map[string]any{
+			"timePeriod": map[string]any{
+				"begin": map[string]any{"timeInstant": date.Format(time.RFC3339)},
+				"end":   map[string]any{"timeInstant": date.Add(24*time.Hour - time.Second).Format(time.RFC3339)},
+			},
+			"variables": variables,
+		})
+	}
+
+	return http.StatusOK, map[string]any{
+		"type": "FeatureCollection",
+		"features": []any{map[string]any{
+			"type": "Feature",
+			"geometry": map[string]any{
+				"type":        "Point",
+				"coordinates": []string{lon, lat},
+			},
+			"properties": map[string]any{"days": days},
+		}},
+	}
+}
+
+// meteoGaliciaVariable returns the hourly values of the variable called name,
+// if MeteoSIX knows it.
+func meteoGaliciaVariable(name string, hours []hour) (map[string]any, bool) {
+	values := make([]any, 0, len(hours))
+	for _, h := range hours {
+		v := map[string]any{"timeInstant": h.Time.Format(time.RFC3339)}
+		switch name {
+		case "temperature":
+			v["value"] = h.Temp
+		case "precipitation_amount":
+			v["value"] = h.Precipitation
+		case "relative_humidity":
+			v["value"] = h.Day.RelativeHumidity
+		case "sky_state":
+			v["value"] = meteoGaliciaSky(h.Day.WMOCode)
+		case "wind":
+			v["moduleValue"] = h.WindSpeed
+			v["directionValue"] = h.WindDirection
+		default:
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	return map[string]any{"name": name, "model": "WRF", "values": values}, true
+}
+
+// meteoGaliciaSky picks the MeteoSIX sky state closest to the WMO code.
+func meteoGaliciaSky(wmo int) string {
+	switch {
+	case wmo == 0:
+		return "SUNNY"
+	case wmo <= 2:
+		return "PARTLY_CLOUDY"
+	case wmo == 3:
+		return "CLOUDY"
+	case wmo <= 48:
+		return "FOG"
+	case wmo <= 57:
+		return "DRIZZLE"
+	case wmo <= 67:
+		return "RAIN"
+	case wmo <= 77:
+		return "SNOW"
+	case wmo <= 86:
+		return "SHOWERS"
+	default:
+		return "STORMS"
+	}
+}
+
+// within reports whether the number v lies between lo and hi.
+func within(v string, lo, hi float64) bool {
+	f, err := strconv.ParseFloat(v, 64)
+	return err == nil && f >= lo && f <= hi
+}
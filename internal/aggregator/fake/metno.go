@@ -0,0 +1,139 @@
+package fake
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// NewMETNorway starts a stand-in for the MET Norway Locationforecast endpoint
+// at /weatherapi/locationforecast/2.0/compact. Like the real one it refuses
+// requests without User-Agent or with more than 4 decimals in the coordinates,
+// and answers If-Modified-Since with 304 Not Modified until the next hour's
+// model run. The timeseries is hourly for 60 hours from the current hour on,
+// then 6-hourly until 10 days ahead.
+func NewMETNorway(tb testing.TB) *Server {
+	return newServer(tb, metNorwayForecast)
+}
+
+func metNorwayForecast(s *Server, h http.Header, r *http.Request) (int, any) {
+	if r.URL.Path != "/weatherapi/locationforecast/2.0/compact" {
+		return http.StatusNotFound, nil
+	}
+	if r.UserAgent() == "" || strings.HasPrefix(r.UserAgent(), "Go-http-client") {
+		return http.StatusForbidden, nil
+	}
+
+	params := r.URL.Query()
+	for _, name := range []string{"lat", "lon"} {
+		if _, decimals, _ := strings.Cut(params.Get(name), "."); len(decimals) > 4 {
+			return http.StatusForbidden, nil
+		}
+	}
+	if !inRange(params.Get("lat"), 90) || !inRange(params.Get("lon"), 180) {
+		return http.StatusBadRequest, nil
+	}
+
+	now := s.today()
+	start := now.Truncate(time.Hour)
+
+	// A new model run every hour, which is fresh for half an hour.
+	h.Set("Last-Modified", start.Format(http.TimeFormat))
+	h.Set("Expires", now.Add(30*time.Minute).Format(http.TimeFormat))
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !since.Before(start) {
+		return http.StatusNotModified, nil
+	}
+
+	series := make([]any, 0, 90)
+	for t := start; t.Before(start.Add(240 * time.Hour)); {
+		hr := s.hourAt(t)
+		data := map[string]any{
+			"instant": map[string]any{"details": map[string]any{
+				"air_temperature":     hr.Temp,
+				"cloud_area_fraction": hr.CloudCover,
+				"relative_humidity":   hr.Day.RelativeHumidity,
+				"wind_from_direction": hr.WindDirection,
+				"wind_speed":          hr.WindSpeed / 3.6,
+			}},
+			"next_6_hours": metNorwayPeriod(s, hr, 6),
+		}
+
+		step := 6 * time.Hour
+		if t.Before(start.Add(60 * time.Hour)) {
+			data["next_1_hours"] = metNorwayPeriod(s, hr, 1)
+			step = time.Hour
+		}
+		series = append(series, map[string]any{
+			"time": t.Format(time.RFC3339),
+			"data": data,
+		})
+
+		t = t.Add(step)
+		if step > time.Hour {
+			// 6-hourly steps are at 00, 06, 12 and 18 UTC.
+			t = t.Truncate(6 * time.Hour)
+		}
+	}
+
+	return http.StatusOK, map[string]any{
+		"type": "Feature",
+		"properties": map[string]any{
+			"meta":       map[string]any{"updated_at": start.Format(time.RFC3339)},
+			"timeseries": series,
+		},
+	}
+}
+
+// metNorwayPeriod summarizes the hours following the hour h with the weather
+// of h. Like the real ones, only periods longer than an hour come with the
+// extremes of the temperature.
+func metNorwayPeriod(s *Server, h hour, hours int) map[string]any {
+	details := map[string]any{"precipitation_amount": h.Precipitation * float32(hours)}
+	if hours > 1 {
+		maxTemp, minTemp := h.Temp, h.Temp
+		for i := 1; i < hours; i++ {
+			t := s.hourAt(h.Time.Add(time.Duration(i) * time.Hour)).Temp
+			maxTemp, minTemp = max(maxTemp, t), min(minTemp, t)
+		}
+		details["air_temperature_max"] = maxTemp
+		details["air_temperature_min"] = minTemp
+	}
+
+	return map[string]any{
+		"summary": map[string]any{"symbol_code": metNorwaySymbol(h.Day.WMOCode, h.Time.Hour())},
+		"details": details,
+	}
+}
+
+// metNorwaySymbol picks the MET Norway symbol code closest to the WMO code,
+// with the suffix of the time of day where the real ones have it.
+func metNorwaySymbol(wmo, hour int) string {
+	suffix := "_night"
+	if hour >= 8 && hour < 18 {
+		suffix = "_day"
+	}
+
+	switch {
+	case wmo == 0:
+		return "clearsky" + suffix
+	case wmo <= 2:
+		return "partlycloudy" + suffix
+	case wmo == 3:
+		return "cloudy"
+	case wmo <= 48:
+		return "fog"
+	case wmo <= 57:
+		return "lightrain"
+	case wmo <= 67:
+		return "rain"
+	case wmo <= 77:
+		return "snow"
+	case wmo <= 82:
+		return "rainshowers" + suffix
+	case wmo <= 86:
+		return "snowshowers" + suffix
+	default:
+		return "rainandthunder"
+	}
+}
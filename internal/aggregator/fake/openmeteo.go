@@ -0,0 +1,126 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// NewOpenMeteo starts a stand-in for the OpenMeteo forecast endpoint at
+// /v1/forecast. It serves the daily values for the requested date range and
+// hourly values from the current hour on, all in UTC as the local time.
+func NewOpenMeteo(tb testing.TB) *Server {
+	return newServer(tb, openMeteoForecast)
+}
+
+// openMeteoDaily yields the `daily` variables of a day by their OpenMeteo names.
+var openMeteoDaily = map[string]func(d Day, date string) any{
+	"temperature_2m_max":            func(d Day, _ string) any { return d.MaxTemp },
+	"temperature_2m_min":            func(d Day, _ string) any { return d.MinTemp },
+	"precipitation_sum":             func(d Day, _ string) any { return d.PrecipitationSum },
+	"precipitation_probability_max": func(d Day, _ string) any { return d.PrecipitationProbability },
+	"wind_speed_10m_max":            func(d Day, _ string) any { return d.MaxWindSpeed },
+	"wind_gusts_10m_max":            func(d Day, _ string) any { return d.MaxWindGust },
+	"wind_direction_10m_dominant":   func(d Day, _ string) any { return d.WindDirection },
+	"relative_humidity_2m_mean":     func(d Day, _ string) any { return d.RelativeHumidity },
+	"uv_index_max":                  func(d Day, _ string) any { return d.UVIndex },
+	"sunrise":                       func(d Day, date string) any { return date + "T" + d.Sunrise },
+	"sunset":                        func(d Day, date string) any { return date + "T" + d.Sunset },
+	"weather_code":                  func(d Day, _ string) any { return d.WMOCode },
+}
+
+// openMeteoHourly yields the `hourly` variables of an hour by their OpenMeteo
+// names.
+var openMeteoHourly = map[string]func(h hour) any{
+	"temperature_2m":            func(h hour) any { return h.Temp },
+	"precipitation":             func(h hour) any { return h.Precipitation },
+	"precipitation_probability": func(h hour) any { return h.PrecipitationProbability },
+	"wind_speed_10m":            func(h hour) any { return h.WindSpeed },
+	"wind_gusts_10m":            func(h hour) any { return h.WindGust },
+	"wind_direction_10m":        func(h hour) any { return h.WindDirection },
+	"cloud_cover":               func(h hour) any { return h.CloudCover },
+	"weather_code":              func(h hour) any { return h.Day.WMOCode },
+}
+
+// openMeteoError is the body OpenMeteo answers bad requests with.
+func openMeteoError(reason string) (int, any) {
+	return http.StatusBadRequest, map[string]any{"error": true, "reason": reason}
+}
+
+func openMeteoForecast(s *Server, _ http.Header, r *http.Request) (int, any) {
+	if r.URL.Path != "/v1/forecast" {
+		return http.StatusNotFound, map[string]any{"error": true, "reason": "Not Found"}
+	}
+
+	params := r.URL.Query()
+	lat, err := strconv.ParseFloat(params.Get("latitude"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return openMeteoError("Latitude must be in range of -90 to 90°.")
+	}
+	lon, err := strconv.ParseFloat(params.Get("longitude"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return openMeteoError("Longitude must be in range of -180 to 180°.")
+	}
+
+	res := map[string]any{
+		"latitude":  lat,
+		"longitude": lon,
+		"timezone":  "GMT",
+	}
+
+	if daily := params.Get("daily"); daily != "" {
+		first, err := time.Parse(time.DateOnly, params.Get("start_date"))
+		if err != nil {
+			return openMeteoError("Parameter 'start_date' is invalid")
+		}
+		last, err := time.Parse(time.DateOnly, params.Get("end_date"))
+		if err != nil || last.Before(first) {
+			return openMeteoError("Parameter 'end_date' is invalid")
+		}
+
+		values := map[string]any{}
+		var dates []string
+		for i, d := 0, first; !d.After(last); i, d = i+1, d.AddDate(0, 0, 1) {
+			date := d.Format(time.DateOnly)
+			dates = append(dates, date)
+			for _, name := range strings.Split(daily, ",") {
+				value, ok := openMeteoDaily[name]
+				if !ok {
+					return openMeteoError(fmt.Sprintf("Cannot initialize WeatherVariable from invalid String value %s", name))
+				}
+				vv, _ := values[name].([]any)
+				values[name] = append(vv, value(s.day(i), date))
+			}
+		}
+		values["time"] = dates
+		res["daily"] = values
+	}
+
+	if hourly := params.Get("hourly"); hourly != "" {
+		hours, err := strconv.Atoi(params.Get("forecast_hours"))
+		if err != nil || hours <= 0 {
+			return openMeteoError("Parameter 'forecast_hours' is invalid")
+		}
+
+		values := map[string]any{}
+		var times []string
+		for _, h := range s.hours(hours) {
+			times = append(times, h.Time.Format("2006-01-02T15:04"))
+			for _, name := range strings.Split(hourly, ",") {
+				value, ok := openMeteoHourly[name]
+				if !ok {
+					return openMeteoError(fmt.Sprintf("Cannot initialize WeatherVariable from invalid String value %s", name))
+				}
+				vv, _ := values[name].([]any)
+				values[name] = append(vv, value(h))
+			}
+		}
+		values["time"] = times
+		res["hourly"] = values
+	}
+
+	return http.StatusOK, res
+}
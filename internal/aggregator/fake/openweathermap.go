@@ -0,0 +1,118 @@
+package fake
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// NewOpenWeatherMap starts a stand-in for the OpenWeatherMap 5 day / 3 hour
+// forecast endpoint at /data/2.5/forecast, which only accepts the API key
+// apikey. Like the real one it serves 40 entries from the next 3 hours on, so
+// after 21:00 they start with tomorrow, in UTC as the local time.
+func NewOpenWeatherMap(tb testing.TB, apikey string) *Server {
+	return newServer(tb, func(s *Server, h http.Header, r *http.Request) (int, any) {
+		return openWeatherMapForecast(s, r, apikey)
+	})
+}
+
+// openWeatherMapError is the body OpenWeatherMap answers failed requests with.
+func openWeatherMapError(status int, message string) (int, any) {
+	return status, map[string]any{"cod": strconv.Itoa(status), "message": message}
+}
+
+func openWeatherMapForecast(s *Server, r *http.Request, apikey string) (int, any) {
+	if r.URL.Path != "/data/2.5/forecast" {
+		return openWeatherMapError(http.StatusNotFound, "Internal error")
+	}
+
+	params := r.URL.Query()
+	if params.Get("appid") != apikey {
+		return openWeatherMapError(http.StatusUnauthorized,
+			"Invalid API key. Please see https://openweathermap.org/faq#error401 for more info.")
+	}
+	if !inRange(params.Get("lat"), 90) {
+		return openWeatherMapError(http.StatusBadRequest, "wrong latitude")
+	}
+	if !inRange(params.Get("lon"), 180) {
+		return openWeatherMapError(http.StatusBadRequest, "wrong longitude")
+	}
+
+	now := s.today()
+	start := now.Truncate(3 * time.Hour).Add(3 * time.Hour)
+
+	list := make([]any, 0, 40)
+	for i := range 40 {
+		h := s.hourAt(start.Add(time.Duration(i*3) * time.Hour))
+		list = append(list, map[string]any{
+			"dt": h.Time.Unix(),
+			"main": map[string]any{
+				"temp":     h.Temp,
+				"temp_min": h.Temp,
+				"temp_max": h.Temp,
+				"humidity": h.Day.RelativeHumidity,
+			},
+			"weather": []any{map[string]any{"id": openWeatherMapCode(h.Day.WMOCode)}},
+			"clouds":  map[string]any{"all": h.CloudCover},
+			"wind": map[string]any{
+				"speed": h.WindSpeed / 3.6,
+				"deg":   h.WindDirection,
+				"gust":  h.WindGust / 3.6,
+			},
+			"pop":    h.PrecipitationProbability / 100,
+			"rain":   map[string]any{"3h": h.Precipitation * 3},
+			"dt_txt": h.Time.Format(time.DateTime),
+		})
+	}
+
+	today := s.day(0)
+	return http.StatusOK, map[string]any{
+		"cod":  "200",
+		"cnt":  len(list),
+		"list": list,
+		"city": map[string]any{
+			"timezone": 0,
+			"sunrise":  clockOn(now, today.Sunrise),
+			"sunset":   clockOn(now, today.Sunset),
+		},
+	}
+}
+
+// openWeatherMapCode picks the OpenWeatherMap condition id closest to the WMO
+// code, so the fake doesn't need yet another code per Day.
+func openWeatherMapCode(wmo int) int {
+	switch {
+	case wmo == 0:
+		return 800
+	case wmo <= 2:
+		return 802
+	case wmo == 3:
+		return 804
+	case wmo <= 48:
+		return 741
+	case wmo <= 57:
+		return 300
+	case wmo <= 67:
+		return 501
+	case wmo <= 77:
+		return 601
+	case wmo <= 82:
+		return 521
+	case wmo <= 86:
+		return 621
+	default:
+		return 211
+	}
+}
+
+// clockOn returns the time like "07:45" on the day of t as Unix time, or zero
+// without a time.
+func clockOn(t time.Time, clock string) int64 {
+	c, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, c.Hour(), c.Minute(), 0, 0, time.UTC).Unix()
+}
@@ -0,0 +1,116 @@
+package fake
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// NewWeatherAPI starts a stand-in for the WeatherAPI forecast endpoint at
+// /v1/forecast.json, which only accepts the API key apikey. It serves `days`
+// days from today on, each with all of its hours, in UTC as the local time.
+func NewWeatherAPI(tb testing.TB, apikey string) *Server {
+	return newServer(tb, func(s *Server, h http.Header, r *http.Request) (int, any) {
+		return weatherAPIForecast(s, r, apikey)
+	})
+}
+
+// weatherAPIError is the body WeatherAPI answers failed requests with.
+func weatherAPIError(status, code int, message string) (int, any) {
+	return status, map[string]any{
+		"error": map[string]any{"code": code, "message": message},
+	}
+}
+
+func weatherAPIForecast(s *Server, r *http.Request, apikey string) (int, any) {
+	if r.URL.Path != "/v1/forecast.json" {
+		return weatherAPIError(http.StatusBadRequest, 1005, "API request url is invalid.")
+	}
+
+	params := r.URL.Query()
+	switch key := params.Get("key"); {
+	case key == "":
+		return weatherAPIError(http.StatusUnauthorized, 1002, "API key is invalid or not provided.")
+	case key != apikey:
+		return weatherAPIError(http.StatusUnauthorized, 2006, "API key provided is invalid.")
+	}
+
+	lat, lon, ok := strings.Cut(params.Get("q"), ",")
+	if !ok || !inRange(lat, 90) || !inRange(lon, 180) {
+		return weatherAPIError(http.StatusBadRequest, 1006, "No matching location found.")
+	}
+
+	days, err := strconv.Atoi(params.Get("days"))
+	if err != nil || days <= 0 {
+		days = 1
+	}
+
+	y, m, d := s.today().Date()
+	first := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	forecastDays := make([]any, 0, days)
+	for i := range days {
+		date := first.AddDate(0, 0, i)
+		day := s.day(i)
+
+		hours := make([]any, 0, 24)
+		for h := range 24 {
+			hr := s.hourAt(date.Add(time.Duration(h) * time.Hour))
+			hours = append(hours, map[string]any{
+				"time_epoch":     hr.Time.Unix(),
+				"time":           hr.Time.Format("2006-01-02 15:04"),
+				"temp_c":         hr.Temp,
+				"precip_mm":      hr.Precipitation,
+				"chance_of_rain": hr.PrecipitationProbability,
+				"wind_degree":    hr.WindDirection,
+				"wind_kph":       hr.WindSpeed,
+				"gust_kph":       hr.WindGust,
+				"cloud":          hr.CloudCover,
+				"condition":      map[string]any{"code": day.WeatherAPICode},
+			})
+		}
+
+		forecastDays = append(forecastDays, map[string]any{
+			"date":       date.Format(time.DateOnly),
+			"date_epoch": date.Unix(),
+			"day": map[string]any{
+				"maxtemp_c":            day.MaxTemp,
+				"mintemp_c":            day.MinTemp,
+				"totalprecip_mm":       day.PrecipitationSum,
+				"daily_chance_of_rain": day.PrecipitationProbability,
+				"maxwind_kph":          day.MaxWindSpeed,
+				"avghumidity":          day.RelativeHumidity,
+				"uv":                   day.UVIndex,
+				"condition":            map[string]any{"code": day.WeatherAPICode},
+			},
+			"astro": map[string]any{
+				"sunrise": twelveHour(day.Sunrise, "No sunrise"),
+				"sunset":  twelveHour(day.Sunset, "No sunset"),
+			},
+			"hour": hours,
+		})
+	}
+
+	return http.StatusOK, map[string]any{
+		"location": map[string]any{"tz_id": "UTC"},
+		"forecast": map[string]any{"forecastday": forecastDays},
+	}
+}
+
+// inRange tells if the coordinate v is a number within ±limit.
+func inRange(v string, limit float64) bool {
+	f, err := strconv.ParseFloat(v, 64)
+	return err == nil && f >= -limit && f <= limit
+}
+
+// twelveHour turns the time like "18:27" into the way WeatherAPI writes it,
+// like "06:27 PM". Without a time, like in polar nights, it returns missing.
+func twelveHour(clock, missing string) string {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return missing
+	}
+	return t.Format("03:04 PM")
+}
@@ -0,0 +1,98 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Classifier judges the failed response of an upstream API by its status code
+// and the start of its body. It returns the kind of the failure, or an empty
+// one to go by the status code, and the details the body tells about it.
+type Classifier func(status int, body []byte) (Kind, string)
+
+// Redacted returns the URL u without the value of the query parameter secret,
+// which holds an API key, so it can show up in logs and error messages.
+func Redacted(u url.URL, secret string) string {
+	params := u.Query()
+	if secret != "" && params.Has(secret) {
+		params.Set(secret, "REDACTED")
+		u.RawQuery = params.Encode()
+	}
+	return u.String()
+}
+
+// StatusError reports the response resp of the provider that came without
+// 200 OK as *ProviderError, classified by the classifier. A nil classifier
+// only goes by the status code. The target is the redacted URL of the call.
+func StatusError(provider string, resp *http.Response, target string, classify Classifier) *ProviderError {
+	// The body only adds details, so failing to read it is fine.
+	bb, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var kind Kind
+	var details string
+	if classify != nil {
+		kind, details = classify(resp.StatusCode, bb)
+	}
+	if kind == "" {
+		kind = StatusKind(resp.StatusCode)
+	}
+
+	return &ProviderError{
+		Provider:   provider,
+		Kind:       kind,
+		RetryAfter: RetryAfter(resp.Header, time.Now()),
+		Err: fmt.Errorf(
+			"GET %s unexpected status, want %d, got %d: %s",
+			target, http.StatusOK, resp.StatusCode, details,
+		),
+	}
+}
+
+// FetchJSON requests the URL u of the provider with the client c and
+// unmarshals the JSON response into v. The query parameter secret, if any, is
+// redacted from errors, failed responses are classified by classify.
+// Failed requests and unexpected responses are reported as *ProviderError or
+// *CanceledError.
+func FetchJSON(ctx context.Context, c *http.Client, provider string, u url.URL, secret string, classify Classifier, v any) error {
+	target := Redacted(u, secret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("Create request for %s failed: %w", target, err)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		// The url.Error repeats the URL including the key.
+		var uErr *url.Error
+		if errors.As(err, &uErr) {
+			err = uErr.Err
+		}
+		return Failed(ctx, provider, fmt.Errorf("Get %s failed: %w", target, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return StatusError(provider, resp, target, classify)
+	}
+
+	bb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Failed(ctx, provider, fmt.Errorf("Reads response data from %s failed: %w", target, err))
+	}
+
+	if err = json.Unmarshal(bb, v); err != nil {
+		return &ProviderError{
+			Provider: provider,
+			Kind:     KindDecode,
+			Err:      fmt.Errorf("Unmarshal response data from %s failed: %w", target, err),
+		}
+	}
+	return nil
+}
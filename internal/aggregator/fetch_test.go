@@ -0,0 +1,74 @@
+package aggregator_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+)
+
+func TestRedacted(t *testing.T) {
+	u, _ := url.Parse("https://example.com/v1?key=secret&q=1")
+	if got, want := aggregator.Redacted(*u, "key"), "https://example.com/v1?key=REDACTED&q=1"; got != want {
+		t.Errorf("Redacted URL must be %s, got %s", want, got)
+	}
+	if got, want := aggregator.Redacted(*u, ""), u.String(); got != want {
+		t.Errorf("URL without secret must stay %s, got %s", want, got)
+	}
+}
+
+type fetchJSONTestValues struct {
+	status int
+	body   string
+	want   aggregator.Kind
+}
+
+func TestFetchJSON(t *testing.T) {
+	classify := func(status int, body []byte) (aggregator.Kind, string) {
+		if strings.Contains(string(body), "coordinates") {
+			return aggregator.KindInvalidLocation, string(body)
+		}
+		return "", string(body)
+	}
+
+	rr := []fetchJSONTestValues{
+		{status: http.StatusOK, body: `{"value":42}`, want: ""},
+		{status: http.StatusOK, body: `{"value":`, want: aggregator.KindDecode},
+		{status: http.StatusBadRequest, body: `invalid coordinates`, want: aggregator.KindInvalidLocation},
+		{status: http.StatusUnauthorized, body: `invalid key`, want: aggregator.KindAuth},
+		{status: http.StatusServiceUnavailable, body: ``, want: aggregator.KindUnavailable},
+	}
+
+	for _, r := range rr {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(r.status)
+			w.Write([]byte(r.body))
+		}))
+		u, _ := url.Parse(srv.URL + "?key=secret")
+
+		var v struct{ Value int }
+		err := aggregator.FetchJSON(context.Background(), srv.Client(), "stub", *u, "key", classify, &v)
+		srv.Close()
+
+		if r.want == "" {
+			if err != nil || v.Value != 42 {
+				t.Errorf("Status %d must decode the body, got %+v and %+v", r.status, v, err)
+			}
+			continue
+		}
+
+		var pErr *aggregator.ProviderError
+		if !errors.As(err, &pErr) || pErr.Kind != r.want || pErr.Provider != "stub" {
+			t.Errorf("Status %d with %#v must be kind %#v, got %+v", r.status, r.body, r.want, err)
+			continue
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Errorf("Error must not leak the API key, got %+v", err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package meteogalicia
+
+import "github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+
+// skyConditions maps the MeteoSIX `sky_state` values onto the canonical
+// conditions.
+// See https://www.meteogalicia.gal/datosred/infoweb/meteo/proxectos/meteosix/API_MeteoSIX_v4_en.pdf
+var skyConditions = map[string]types.Condition{
+	"SUNNY":                types.ConditionClear,
+	"HIGH_CLOUDS":          types.ConditionPartlyCloudy,
+	"MID_CLOUDS":           types.ConditionPartlyCloudy,
+	"PARTLY_CLOUDY":        types.ConditionPartlyCloudy,
+	"CLOUDY":               types.ConditionCloudy,
+	"OVERCAST":             types.ConditionOvercast,
+	"MIST":                 types.ConditionFog,
+	"FOG":                  types.ConditionFog,
+	"FOG_BANK":             types.ConditionFog,
+	"DRIZZLE":              types.ConditionDrizzle,
+	"WEAK_RAIN":            types.ConditionLightRain,
+	"INTERMITENT_RAIN":     types.ConditionLightRain,
+	"RAIN":                 types.ConditionRain,
+	"WEAK_SHOWERS":         types.ConditionRainShowers,
+	"SHOWERS":              types.ConditionRainShowers,
+	"OVERCAST_AND_SHOWERS": types.ConditionRainShowers,
+	"MELTED_SNOW":          types.ConditionSleet,
+	"SNOW":                 types.ConditionSnow,
+	"STORMS":               types.ConditionThunderstorm,
+	"STORM_THEN_CLOUDY":    types.ConditionThunderstorm,
+	"RAIN_HAIL":            types.ConditionThunderstormHail,
+}
+
+// conditionOf maps the sky state onto the canonical condition.
+func conditionOf(state string) types.Condition {
+	if res, ok := skyConditions[state]; ok {
+		return res
+	}
+	return types.ConditionUnknown
+}
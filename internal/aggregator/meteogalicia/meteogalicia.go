@@ -0,0 +1,332 @@
+package meteogalicia
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// Caller shall implement the api.Aggregator interface to call the MeteoSIX API
+// of MeteoGalicia.
+type Caller struct {
+	client *http.Client
+	apikey string
+	clock  func() time.Time
+	base   url.URL
+}
+
+// DefaultBaseURL is where the MeteoSIX API lives.
+const DefaultBaseURL = "https://servizos.meteogalicia.gal"
+
+// NewCaller creates a pre-configured caller that uses the provided API key and
+// retries failed calls according to the policy retry.
+// A nil base calls the DefaultBaseURL.
+func NewCaller(apikey string, base *url.URL, retry aggregator.RetryPolicy) (*Caller, error) {
+	return DebuggingCaller(apikey, base, aggregator.NewClient(retry), time.Now)
+}
+
+// DebuggingCaller lets inject non-default implementation for testing and
+// debugging sessions, i.e. the base URL of a httptest.Server.
+// A nil base calls the DefaultBaseURL.
+func DebuggingCaller(key string, base *url.URL, c *http.Client, cf func() time.Time) (*Caller, error) {
+	if key == "" {
+		return nil, aggregator.ErrNoApiKeyProvided
+	}
+	if base == nil {
+		base, _ = url.Parse(DefaultBaseURL)
+	}
+	return &Caller{
+		apikey: key,
+		client: c,
+		clock:  cf,
+		base:   *base,
+	}, nil
+}
+
+// maxForecastDays covers today and the next 3 days, as far as the WRF model of
+// MeteoGalicia reaches.
+const maxForecastDays = 4
+
+// ProviderName identifies this provider in errors and in the provider registry.
+const ProviderName = "meteogalicia"
+
+// DisplayName, Attribution and AttributionURL credit MeteoGalicia next to its
+// forecasts, as its terms of use require.
+const (
+	DisplayName    = "MeteoGalicia"
+	Attribution    = "Weather data by MeteoGalicia, Xunta de Galicia"
+	AttributionURL = "https://www.meteogalicia.gal/"
+)
+
+// variables lists the MeteoSIX variables the forecast is made of.
+const variables = "temperature,wind,precipitation_amount,relative_humidity,sky_state"
+
+// apiKeyParam is the query parameter holding the API key.
+const apiKeyParam = "API_KEY"
+
+// missing is what MeteoSIX answers for values it has no forecast of.
+const missing = -9999
+
+// wrapper is the top level GeoJSON object of the API response. Failed calls
+// answer with the exception instead of the features.
+type wrapper struct {
+	Features []struct {
+		Properties struct {
+			Days []day `json:"days"`
+		} `json:"properties"`
+	} `json:"features"`
+	Exception *exception `json:"exception"`
+}
+
+// exception explains why MeteoSIX refused to answer.
+type exception struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// day holds the hourly values of the variables on a single local day, which
+// begins at the time instant of the time period.
+type day struct {
+	TimePeriod struct {
+		Begin struct {
+			TimeInstant time.Time `json:"timeInstant"`
+		} `json:"begin"`
+	} `json:"timePeriod"`
+	Variables []variable `json:"variables"`
+}
+
+// variable holds the values of the variable called Name. Temperatures come in
+// °C, precipitation in l/m² per hour and wind in km/h, from where it blows.
+type variable struct {
+	Name   string  `json:"name"`
+	Values []value `json:"values"`
+}
+
+// value is the value of a variable at a time instant. Wind comes as module and
+// direction, sky states as text and everything else as number.
+type value struct {
+	TimeInstant    time.Time       `json:"timeInstant"`
+	Value          json.RawMessage `json:"value"`
+	ModuleValue    float32         `json:"moduleValue"`
+	DirectionValue float32         `json:"directionValue"`
+}
+
+// number returns the numeric value, unless it's missing.
+func (v value) number() (float32, bool) {
+	var res float32
+	if err := json.Unmarshal(v.Value, &res); err != nil || res == missing {
+		return 0, false
+	}
+	return res, true
+}
+
+// AggregateWeather implements the api.Aggregator interface on Caller.
+// All days come with a single request, already grouped in the local time of
+// Galicia.
+func (c *Caller) AggregateWeather(ctx context.Context, q types.Query) (types.DailyForecast, error) {
+	if q.Days > maxForecastDays {
+		return nil, &aggregator.HorizonError{
+			Provider:  ProviderName,
+			Max:       maxForecastDays,
+			Requested: q.Days,
+			Unit:      "days",
+		}
+	}
+
+	u := c.forecastURL(q.Lat, q.Lon)
+
+	var tmp wrapper
+	if err := c.fetch(ctx, u, &tmp); err != nil {
+		return nil, aggregator.Failed(ctx, ProviderName, err)
+	}
+	if e := tmp.Exception; e != nil {
+		return nil, &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     exceptionKind(*e),
+			Err: fmt.Errorf(
+				"GET %s unexpected exception: %d %s",
+				aggregator.Redacted(u, apiKeyParam), e.Code, e.Message,
+			),
+		}
+	}
+
+	var days []day
+	if len(tmp.Features) > 0 {
+		days = tmp.Features[0].Properties.Days
+	}
+	if err := contiguous(days, c.clock(), q.Days); err != nil {
+		return nil, &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     aggregator.KindDecode,
+			Err:      fmt.Errorf("Invalid response data from %s: %w", aggregator.Redacted(u, apiKeyParam), err),
+		}
+	}
+
+	res := make(types.DailyForecast, 0, q.Days)
+	for _, d := range days[:q.Days] {
+		res = append(res, d.toForecast(q))
+	}
+	return res, nil
+}
+
+// MaxForecastDays implements the api.Aggregator interface and reports how many
+// days ahead the API is able to forecast.
+func (c *Caller) MaxForecastDays() int {
+	return maxForecastDays
+}
+
+// Variables implements the api.VariableAggregator interface. The numeric
+// forecast has neither probabilities, gusts nor the UV index, and MeteoSIX
+// serves sunrise and sunset with another call.
+func (c *Caller) Variables() []types.Variable {
+	return []types.Variable{
+		types.VarMaxTemp, types.VarMinTemp, types.VarPrecipitationSum,
+		types.VarMaxWindSpeed, types.VarWindDirection, types.VarRelativeHumidity,
+		types.VarCondition,
+	}
+}
+
+// date returns the local date of the day.
+func (d day) date() string {
+	return d.TimePeriod.Begin.TimeInstant.Format(time.DateOnly)
+}
+
+// contiguous checks the response holds `days` days, starting with today where
+// the days begin and each one following the day before.
+func contiguous(dd []day, now time.Time, days int) error {
+	if len(dd) < days {
+		return fmt.Errorf("received %d of %d forecasts", len(dd), days)
+	}
+
+	today := now.In(dd[0].TimePeriod.Begin.TimeInstant.Location())
+	for i, d := range dd[:days] {
+		if want := today.AddDate(0, 0, i).Format(time.DateOnly); d.date() != want {
+			return fmt.Errorf("day %d is %s, want %s", i, d.date(), want)
+		}
+	}
+	return nil
+}
+
+// toForecast summarizes the hourly values of the day into the exchange format,
+// only filling the values the query asked for and MeteoSIX has.
+func (d day) toForecast(q types.Query) types.Forecast {
+	res := types.Forecast{Date: d.date()}
+
+	var temps, humidities int
+	var humidity float64
+	var winds []aggregator.Wind
+	var conditions []types.Condition
+	for _, v := range d.Variables {
+		for _, val := range v.Values {
+			switch v.Name {
+			case "temperature":
+				t, ok := val.number()
+				if !ok {
+					continue
+				}
+				if temps == 0 || t > res.MaxTemp {
+					res.MaxTemp = t
+				}
+				if temps == 0 || t < res.MinTemp {
+					res.MinTemp = t
+				}
+				temps++
+
+			case "precipitation_amount":
+				if p, ok := val.number(); ok {
+					res.PrecipitationSum += p
+				}
+
+			case "relative_humidity":
+				if h, ok := val.number(); ok {
+					humidity += float64(h)
+					humidities++
+				}
+
+			case "wind":
+				if val.ModuleValue == missing || val.DirectionValue == missing {
+					continue
+				}
+				res.MaxWindSpeed = max(res.MaxWindSpeed, val.ModuleValue)
+				winds = append(winds, aggregator.Wind{Speed: val.ModuleValue, Direction: val.DirectionValue})
+
+			case "sky_state":
+				var s string
+				if err := json.Unmarshal(val.Value, &s); err == nil {
+					conditions = append(conditions, conditionOf(s))
+				}
+			}
+		}
+	}
+	if humidities > 0 {
+		res.RelativeHumidity = float32(math.Round(humidity / float64(humidities)))
+	}
+	res.PrecipitationSum = float32(math.Round(float64(res.PrecipitationSum)*10) / 10)
+	res.MaxWindSpeed = float32(math.Round(float64(res.MaxWindSpeed)*10) / 10)
+	res.WindDirection = aggregator.DominantDirection(winds)
+	res.Condition = aggregator.WorstCondition(conditions)
+
+	return aggregator.Filter(res, q)
+}
+
+// forecastURL generates the API endpoint URL of the forecast at the location.
+// MeteoSIX expects the coordinates as longitude first.
+func (c *Caller) forecastURL(lat, lon float64) url.URL {
+	res := c.base.JoinPath("apiv4", "getNumericForecastInfo")
+	res.RawQuery = fmt.Sprintf(
+		"coords=%f,%f&variables=%s&format=application/json&%s=%s",
+		lon, lat, variables, apiKeyParam, c.apikey,
+	)
+	return *res
+}
+
+// fetch unmarshals the JSON response of the URL u into v. Exceptions that come
+// with 200 OK are left to the caller.
+func (c *Caller) fetch(ctx context.Context, u url.URL, v any) error {
+	return aggregator.FetchJSON(ctx, c.client, ProviderName, u, apiKeyParam, classify, v)
+}
+
+// classify explains failed responses by the exception in their body. Without
+// one they go by their status code, bad requests count as unavailable then.
+func classify(status int, body []byte) (aggregator.Kind, string) {
+	var res wrapper
+	// The exception only adds details, so a body that doesn't fit is fine.
+	_ = json.Unmarshal(body, &res)
+
+	e := res.Exception
+	if e == nil {
+		if kind := aggregator.StatusKind(status); kind != "" {
+			return kind, ""
+		}
+		return aggregator.KindUnavailable, ""
+	}
+	return exceptionKind(*e), fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// exceptionKind classifies the exception e. Its codes aren't documented as
+// stable, so the message tells about locations outside of the area MeteoSIX
+// covers, exhausted quotas and invalid keys, in that order. Messages about
+// the area may mention its limits and the ones about the quota the key, so
+// the more specific wording is checked first. Any other exception is a
+// failure of MeteoSIX, whatever the status code.
+func exceptionKind(e exception) aggregator.Kind {
+	msg := strings.ToLower(e.Message)
+	switch {
+	case strings.Contains(msg, "outside"):
+		return aggregator.KindInvalidLocation
+	case strings.Contains(msg, "quota") || strings.Contains(msg, "exceeded"):
+		return aggregator.KindRateLimited
+	case strings.Contains(msg, "api_key") || strings.Contains(msg, "api key"):
+		return aggregator.KindAuth
+	default:
+		return aggregator.KindUnavailable
+	}
+}
@@ -0,0 +1,167 @@
+package meteogalicia_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/aggregatortest"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/fake"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/meteogalicia"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// TestConformance runs the conformance suite against the fake MeteoSIX server.
+func TestConformance(t *testing.T) {
+	srv := fake.NewMeteoGalicia(t, "secret")
+	aggregatortest.Run(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			sut, err := meteogalicia.DebuggingCaller("secret", srv.BaseURL(), client, time.Now)
+			if err != nil {
+				t.Fatalf("creating DebuggingCaller: %+v", err)
+			}
+			return sut
+		},
+		Upstream: srv.Client().Transport,
+		Secret:   "secret",
+	})
+}
+
+// TestDays verifies the hourly values are summed up per local day, skipping
+// the ones MeteoSIX has no forecast of.
+func TestDays(t *testing.T) {
+	body := `{"type":"FeatureCollection","features":[{"type":"Feature",
+		"geometry":{"type":"Point","coordinates":[-8.8201753,42.6493934]},
+		"properties":{"days":[
+			{"timePeriod":{"begin":{"timeInstant":"2024-11-05T00:00:00+01:00"},"end":{"timeInstant":"2024-11-05T23:59:59+01:00"}},
+			 "variables":[
+				{"name":"temperature","model":"WRF","units":"degc","values":[
+					{"timeInstant":"2024-11-05T00:00:00+01:00","value":11.2},
+					{"timeInstant":"2024-11-05T12:00:00+01:00","value":18.6},
+					{"timeInstant":"2024-11-05T18:00:00+01:00","value":-9999}]},
+				{"name":"wind","model":"WRF","moduleUnits":"kmh","directionUnits":"deg","values":[
+					{"timeInstant":"2024-11-05T00:00:00+01:00","moduleValue":10,"directionValue":0},
+					{"timeInstant":"2024-11-05T12:00:00+01:00","moduleValue":10,"directionValue":90},
+					{"timeInstant":"2024-11-05T18:00:00+01:00","moduleValue":-9999,"directionValue":-9999}]},
+				{"name":"precipitation_amount","model":"WRF","units":"lm2","values":[
+					{"timeInstant":"2024-11-05T00:00:00+01:00","value":0.4},
+					{"timeInstant":"2024-11-05T12:00:00+01:00","value":1.3},
+					{"timeInstant":"2024-11-05T18:00:00+01:00","value":-9999}]},
+				{"name":"relative_humidity","model":"WRF","units":"%","values":[
+					{"timeInstant":"2024-11-05T00:00:00+01:00","value":90},
+					{"timeInstant":"2024-11-05T12:00:00+01:00","value":71}]},
+				{"name":"sky_state","model":"WRF","values":[
+					{"timeInstant":"2024-11-05T00:00:00+01:00","value":"OVERCAST"},
+					{"timeInstant":"2024-11-05T12:00:00+01:00","value":"WEAK_RAIN"},
+					{"timeInstant":"2024-11-05T18:00:00+01:00","value":"HIGH_CLOUDS"}]}]}]}}]}`
+
+	client := aggregatortest.Respond(http.StatusOK, nil, body)
+	// Still the 4th in UTC, but already the 5th in Galicia.
+	now := func() time.Time {
+		return time.Date(2024, 11, 4, 23, 30, 0, 0, time.UTC)
+	}
+	sut, err := meteogalicia.DebuggingCaller("secret", nil, client, now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 1})
+	if err != nil {
+		t.Fatalf("aggregate: %+v", err)
+	}
+
+	want := types.DailyForecast{{
+		Date:             "2024-11-05",
+		MaxTemp:          18.6,
+		MinTemp:          11.2,
+		PrecipitationSum: 1.7,
+		MaxWindSpeed:     10,
+		WindDirection:    45,
+		RelativeHumidity: 81,
+		Condition:        types.ConditionLightRain,
+	}}
+
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+// TestErrorKinds verifies failed calls are classified by the exception
+// MeteoSIX answers with, even with 200 OK. Only locations outside of its area
+// are invalid ones.
+func TestErrorKinds(t *testing.T) {
+	aggregatortest.RunErrorKinds(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			sut, err := meteogalicia.DebuggingCaller("secret", nil, client, time.Now)
+			if err != nil {
+				t.Fatalf("creating DebuggingCaller: %+v", err)
+			}
+			return sut
+		},
+		Secret: "secret",
+	}, []aggregatortest.ErrorCase{
+		{
+			Name:   "invalid key",
+			Status: http.StatusUnauthorized,
+			Body:   `{"exception":{"code":209,"message":"The API_KEY is not valid"}}`,
+			Kind:   aggregator.KindAuth,
+		},
+		{
+			Name:   "outside of Galicia",
+			Status: http.StatusBadRequest,
+			Body:   `{"exception":{"code":221,"message":"The coordinates are outside the area covered"}}`,
+			Kind:   aggregator.KindInvalidLocation,
+		},
+		{
+			Name:   "outside of the limits",
+			Status: http.StatusBadRequest,
+			Body:   `{"exception":{"code":221,"message":"The coordinates are outside the limits of the area covered"}}`,
+			Kind:   aggregator.KindInvalidLocation,
+		},
+		{
+			Name:   "quota exceeded",
+			Status: http.StatusForbidden,
+			Body:   `{"exception":{"code":210,"message":"The API_KEY has exceeded its daily quota"}}`,
+			Kind:   aggregator.KindRateLimited,
+		},
+		{
+			Name:   "limit of requests exceeded",
+			Status: http.StatusForbidden,
+			Body:   `{"exception":{"code":210,"message":"Maximum number of requests exceeded"}}`,
+			Kind:   aggregator.KindRateLimited,
+		},
+		{
+			Name:   "malformed coordinates",
+			Status: http.StatusBadRequest,
+			Body:   `{"exception":{"code":220,"message":"The coords parameter is not valid"}}`,
+			Kind:   aggregator.KindUnavailable,
+		},
+		{
+			Name:   "internal exception",
+			Status: http.StatusBadRequest,
+			Body:   `{"exception":{"code":500,"message":"Unexpected error"}}`,
+			Kind:   aggregator.KindUnavailable,
+		},
+		{
+			Name:   "exception with 200",
+			Status: http.StatusOK,
+			Body:   `{"exception":{"code":209,"message":"The API_KEY is not valid"}}`,
+			Kind:   aggregator.KindAuth,
+		},
+	})
+}
+
+// TestMissingKey verifies the caller refuses to work without an API key.
+func TestMissingKey(t *testing.T) {
+	_, err := meteogalicia.DebuggingCaller("", nil, &http.Client{}, time.Now)
+	if !errors.Is(err, aggregator.ErrNoApiKeyProvided) {
+		t.Errorf("Missing key must return ErrNoApiKeyProvided, got %+v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package metno
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCached limits the number of locations in the cache.
+const maxCached = 1024
+
+// entry is a cached response body with the validators of its response.
+type entry struct {
+	body         []byte
+	expires      time.Time
+	lastModified string
+}
+
+// cache keeps the responses of MET Norway per URL, as its terms of service ask
+// for not calling again before the response expires. All callers of the
+// caller share it.
+type cache struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+func newCache() *cache {
+	return &cache{entries: make(map[string]entry)}
+}
+
+// get returns the entry of the URL u, whether it's stale or not.
+func (c *cache) get(u string) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[u]
+	return e, ok
+}
+
+// put stores the entry of the URL u. Once the cache is full the entries that
+// expired before now are dropped, and if that's not enough, some random other
+// ones.
+func (c *cache) put(u string, e entry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[u]; !ok && len(c.entries) >= maxCached {
+		for k, old := range c.entries {
+			if old.expires.Before(now) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < maxCached {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[u] = e
+}
@@ -0,0 +1,51 @@
+package metno
+
+import (
+	"strings"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// symbolConditions maps the MET Norway symbol codes onto the canonical
+// conditions. The codes come with a suffix like "_day" or "_night" for the
+// ones that look different at night, which is cut off before.
+// See https://api.met.no/weatherapi/weathericon/2.0/documentation
+var symbolConditions = map[string]types.Condition{
+	"clearsky":     types.ConditionClear,
+	"fair":         types.ConditionClear,
+	"partlycloudy": types.ConditionPartlyCloudy,
+	"cloudy":       types.ConditionOvercast,
+	"fog":          types.ConditionFog,
+
+	"lightrain":         types.ConditionLightRain,
+	"rain":              types.ConditionRain,
+	"heavyrain":         types.ConditionHeavyRain,
+	"lightrainshowers":  types.ConditionRainShowers,
+	"rainshowers":       types.ConditionRainShowers,
+	"heavyrainshowers":  types.ConditionHeavyRain,
+	"lightsleet":        types.ConditionSleet,
+	"sleet":             types.ConditionSleet,
+	"heavysleet":        types.ConditionSleet,
+	"lightsleetshowers": types.ConditionSleet,
+	"sleetshowers":      types.ConditionSleet,
+	"heavysleetshowers": types.ConditionSleet,
+	"lightsnow":         types.ConditionLightSnow,
+	"snow":              types.ConditionSnow,
+	"heavysnow":         types.ConditionHeavySnow,
+	"lightsnowshowers":  types.ConditionSnowShowers,
+	"snowshowers":       types.ConditionSnowShowers,
+	"heavysnowshowers":  types.ConditionHeavySnow,
+}
+
+// conditionOf maps a symbol code onto the canonical condition. All the many
+// codes "…andthunder" are thunderstorms.
+func conditionOf(symbol string) types.Condition {
+	code, _, _ := strings.Cut(symbol, "_")
+	if strings.HasSuffix(code, "andthunder") {
+		return types.ConditionThunderstorm
+	}
+	if res, ok := symbolConditions[code]; ok {
+		return res
+	}
+	return types.ConditionUnknown
+}
@@ -0,0 +1,384 @@
+package metno
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// ErrNoUserAgent is returned for callers without User-Agent, as MET Norway
+// blocks anonymous clients.
+var ErrNoUserAgent = errors.New("identifying User-Agent missing")
+
+// Caller shall implement the api.Aggregator interface to call the MET Norway
+// Locationforecast API.
+type Caller struct {
+	client    *http.Client
+	userAgent string
+	clock     func() time.Time
+	base      url.URL
+	cache     *cache
+}
+
+// DefaultBaseURL is where the MET Norway API lives.
+const DefaultBaseURL = "https://api.met.no"
+
+// NewCaller creates a pre-configured caller that identifies itself with the
+// userAgent and retries failed calls according to the policy retry.
+// The terms of service ask for the name of the application and a way to contact
+// its operators, like "acme-weather/1.0 ops@acme.example".
+// A nil base calls the DefaultBaseURL.
+func NewCaller(userAgent string, base *url.URL, retry aggregator.RetryPolicy) (*Caller, error) {
+	return DebuggingCaller(userAgent, base, aggregator.NewClient(retry), time.Now)
+}
+
+// DebuggingCaller lets inject non-default implementation for testing and
+// debugging sessions, i.e. the base URL of a httptest.Server.
+// A nil base calls the DefaultBaseURL.
+func DebuggingCaller(userAgent string, base *url.URL, c *http.Client, cf func() time.Time) (*Caller, error) {
+	if userAgent == "" {
+		return nil, ErrNoUserAgent
+	}
+	if base == nil {
+		base, _ = url.Parse(DefaultBaseURL)
+	}
+	return &Caller{
+		client:    c,
+		userAgent: userAgent,
+		clock:     cf,
+		base:      *base,
+		cache:     newCache(),
+	}, nil
+}
+
+// maxForecastDays stops short of the end of the timeseries, which reaches about
+// 10 days ahead, the last one of them partly.
+const maxForecastDays = 9
+
+// ProviderName identifies this provider in errors and in the provider registry.
+const ProviderName = "metno"
+
+// DisplayName, Attribution and AttributionURL credit MET Norway next to its
+// forecasts, as its CC BY 4.0 license requires.
+const (
+	DisplayName    = "MET Norway"
+	Attribution    = "Weather data by MET Norway (CC BY 4.0)"
+	AttributionURL = "https://api.met.no/"
+)
+
+// wrapper is the top level GeoJSON object of the API response.
+type wrapper struct {
+	Properties struct {
+		Timeseries []step `json:"timeseries"`
+	} `json:"properties"`
+}
+
+// step holds the values at Time, which is in UTC. The instant values are the
+// ones at that time, the periods sum up the following hours. Hourly steps come
+// with the next hour, the 6-hourly ones further ahead only with the next 6.
+type step struct {
+	Time time.Time `json:"time"`
+	Data struct {
+		Instant struct {
+			Details struct {
+				AirTemperature    float32 `json:"air_temperature"`
+				RelativeHumidity  float32 `json:"relative_humidity"`
+				WindSpeed         float32 `json:"wind_speed"`
+				WindFromDirection float32 `json:"wind_from_direction"`
+			} `json:"details"`
+		} `json:"instant"`
+		Next1Hours *period `json:"next_1_hours"`
+		Next6Hours *period `json:"next_6_hours"`
+	} `json:"data"`
+}
+
+// period holds the summary of the hours following a step. Only the 6-hourly
+// ones come with the extremes of the air temperature.
+type period struct {
+	Summary struct {
+		SymbolCode string `json:"symbol_code"`
+	} `json:"summary"`
+	Details struct {
+		PrecipitationAmount float32  `json:"precipitation_amount"`
+		AirTemperatureMax   *float32 `json:"air_temperature_max"`
+		AirTemperatureMin   *float32 `json:"air_temperature_min"`
+	} `json:"details"`
+}
+
+// AggregateWeather implements the api.Aggregator interface on Caller.
+// The whole timeseries comes with a single request, which is cached as long as
+// MET Norway allows. It is grouped into days in the timezone of the location,
+// as MET Norway only speaks UTC.
+func (c *Caller) AggregateWeather(ctx context.Context, q types.Query) (types.DailyForecast, error) {
+	if q.Days > maxForecastDays {
+		return nil, &aggregator.HorizonError{
+			Provider:  ProviderName,
+			Max:       maxForecastDays,
+			Requested: q.Days,
+			Unit:      "days",
+		}
+	}
+
+	u := c.forecastURL(q.Lat, q.Lon)
+
+	var tmp wrapper
+	if err := c.fetch(ctx, u, &tmp); err != nil {
+		return nil, aggregator.Failed(ctx, ProviderName, err)
+	}
+
+	zone := zoneOf(q.Lat, q.Lon)
+	days := group(tmp.Properties.Timeseries, zone, c.clock().In(zone))
+	if err := contiguous(days, c.clock().In(zone), q.Days); err != nil {
+		return nil, &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     aggregator.KindDecode,
+			Err:      fmt.Errorf("Invalid response data from %s: %w", u.String(), err),
+		}
+	}
+
+	res := make(types.DailyForecast, 0, q.Days)
+	for _, d := range days[:q.Days] {
+		res = append(res, d.toForecast(q))
+	}
+	return res, nil
+}
+
+// MaxForecastDays implements the api.Aggregator interface and reports how many
+// days ahead the API is able to forecast.
+func (c *Caller) MaxForecastDays() int {
+	return maxForecastDays
+}
+
+// Variables implements the api.VariableAggregator interface. The compact
+// forecast has neither probabilities, gusts nor the UV index, and MET Norway
+// serves sunrise and sunset with another API.
+func (c *Caller) Variables() []types.Variable {
+	return []types.Variable{
+		types.VarMaxTemp, types.VarMinTemp, types.VarPrecipitationSum,
+		types.VarMaxWindSpeed, types.VarWindDirection, types.VarRelativeHumidity,
+		types.VarCondition,
+	}
+}
+
+// day holds the steps of a single local day.
+type day struct {
+	date  string
+	steps []step
+	// precipitation sums up the periods starting on the day.
+	precipitation float32
+	// conditions lists the conditions of the periods starting on the day.
+	conditions []types.Condition
+	// temperatures lists the instant ones and the extremes of the 6-hourly
+	// periods starting on the day, which the instants in between miss.
+	temperatures []float32
+}
+
+// group sorts the steps from today on into local days. The precipitation of
+// every hour is counted once, from the hourly period where there is one.
+// Hourly steps don't need the temperature extremes, their instants cover them.
+func group(ss []step, zone *time.Location, today time.Time) []day {
+	first := today.Format(time.DateOnly)
+
+	var res []day
+	var covered time.Time
+	for i, s := range ss {
+		date := s.Time.In(zone).Format(time.DateOnly)
+		if date < first {
+			continue
+		}
+		if len(res) == 0 || res[len(res)-1].date != date {
+			res = append(res, day{date: date})
+		}
+		d := &res[len(res)-1]
+		d.steps = append(d.steps, s)
+		d.temperatures = append(d.temperatures, s.Data.Instant.Details.AirTemperature)
+
+		hourly := i+1 < len(ss) && ss[i+1].Time.Sub(s.Time) <= time.Hour
+		switch {
+		case s.Data.Next1Hours != nil && (hourly || s.Data.Next6Hours == nil):
+			d.precipitation += s.Data.Next1Hours.Details.PrecipitationAmount
+			d.conditions = append(d.conditions, conditionOf(s.Data.Next1Hours.Summary.SymbolCode))
+			covered = s.Time.Add(time.Hour)
+		case s.Data.Next6Hours != nil && !s.Time.Before(covered):
+			d.precipitation += s.Data.Next6Hours.Details.PrecipitationAmount
+			d.conditions = append(d.conditions, conditionOf(s.Data.Next6Hours.Summary.SymbolCode))
+			if v := s.Data.Next6Hours.Details.AirTemperatureMax; v != nil {
+				d.temperatures = append(d.temperatures, *v)
+			}
+			if v := s.Data.Next6Hours.Details.AirTemperatureMin; v != nil {
+				d.temperatures = append(d.temperatures, *v)
+			}
+			covered = s.Time.Add(6 * time.Hour)
+		}
+	}
+	return res
+}
+
+// contiguous checks the response holds `days` days, starting with today and
+// each one following the day before.
+func contiguous(dd []day, today time.Time, days int) error {
+	if len(dd) < days {
+		return fmt.Errorf("received %d of %d forecasts", len(dd), days)
+	}
+
+	for i, d := range dd[:days] {
+		if want := today.AddDate(0, 0, i).Format(time.DateOnly); d.date != want {
+			return fmt.Errorf("day %d is %s, want %s", i, d.date, want)
+		}
+	}
+	return nil
+}
+
+// toForecast summarizes the steps of the day into the exchange format, only
+// filling the values the query asked for and MET Norway has.
+func (d day) toForecast(q types.Query) types.Forecast {
+	res := types.Forecast{Date: d.date}
+
+	var maxWind float32
+	var humidity float64
+	winds := make([]aggregator.Wind, 0, len(d.steps))
+	for _, s := range d.steps {
+		v := s.Data.Instant.Details
+		maxWind = max(maxWind, v.WindSpeed*aggregator.MsToKmh)
+		humidity += float64(v.RelativeHumidity)
+		winds = append(winds, aggregator.Wind{Speed: v.WindSpeed, Direction: v.WindFromDirection})
+	}
+
+	if q.Wants(types.VarMaxTemp) {
+		res.MaxTemp = slices.Max(d.temperatures)
+	}
+	if q.Wants(types.VarMinTemp) {
+		res.MinTemp = slices.Min(d.temperatures)
+	}
+	if q.Wants(types.VarPrecipitationSum) {
+		res.PrecipitationSum = float32(math.Round(float64(d.precipitation)*10) / 10)
+	}
+	if q.Wants(types.VarMaxWindSpeed) {
+		res.MaxWindSpeed = float32(math.Round(float64(maxWind)*10) / 10)
+	}
+	if q.Wants(types.VarWindDirection) {
+		res.WindDirection = aggregator.DominantDirection(winds)
+	}
+	if q.Wants(types.VarRelativeHumidity) {
+		res.RelativeHumidity = float32(math.Round(humidity / float64(len(d.steps))))
+	}
+	if q.Wants(types.VarCondition) {
+		res.Condition = aggregator.WorstCondition(d.conditions)
+	}
+	return res
+}
+
+// forecastURL generates the API endpoint URL of the forecast at the location.
+// The terms of service refuse coordinates with more than 4 decimals, as they
+// would spoil the caching of the API.
+func (c *Caller) forecastURL(lat, lon float64) url.URL {
+	res := c.base.JoinPath("weatherapi", "locationforecast", "2.0", "compact")
+	res.RawQuery = fmt.Sprintf("lat=%.4f&lon=%.4f", truncate(lat), truncate(lon))
+	return *res
+}
+
+// truncate cuts the coordinate v down to 4 decimals.
+func truncate(v float64) float64 {
+	return math.Trunc(v*1e4) / 1e4
+}
+
+// fetch requests the URL u unless its response is still fresh in the cache and
+// unmarshals the JSON response into v. Stale responses are revalidated with
+// If-Modified-Since, as the terms of service ask for.
+func (c *Caller) fetch(ctx context.Context, u url.URL, v any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	e, ok := c.cache.get(u.String())
+	if !ok || !c.clock().Before(e.expires) {
+		fresh, err := c.request(ctx, u, e)
+		if err != nil {
+			return err
+		}
+		e = fresh
+	}
+
+	if err := json.Unmarshal(e.body, v); err != nil {
+		return &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     aggregator.KindDecode,
+			Err:      fmt.Errorf("Unmarshal response data from %s failed: %w", u.String(), err),
+		}
+	}
+	return nil
+}
+
+// request calls the API and caches the response. With a stale response in the
+// cache it's only sent again if it was modified since.
+func (c *Caller) request(ctx context.Context, u url.URL, stale entry) (entry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return entry{}, fmt.Errorf("Create request for %s failed: %w", u.String(), err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if stale.lastModified != "" {
+		req.Header.Set("If-Modified-Since", stale.lastModified)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return entry{}, aggregator.Failed(ctx, ProviderName, fmt.Errorf("Get %s failed: %w", u.String(), err))
+	}
+	defer resp.Body.Close()
+
+	res := entry{
+		expires:      c.expires(resp.Header),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if stale.body == nil {
+			return entry{}, statusError(resp, u)
+		}
+		res.body = stale.body
+		res.lastModified = cmp.Or(res.lastModified, stale.lastModified)
+
+	case http.StatusOK, http.StatusNonAuthoritativeInfo:
+		// 203 announces the deprecation of the API version, the data is fine.
+		res.body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return entry{}, aggregator.Failed(ctx, ProviderName, fmt.Errorf("Reads response data from %s failed: %w", u.String(), err))
+		}
+
+	default:
+		return entry{}, statusError(resp, u)
+	}
+
+	c.cache.put(u.String(), res, c.clock())
+	return res, nil
+}
+
+// expires returns until when the response with the header h is fresh. Without
+// a valid Expires header it needs to be revalidated with the next call.
+func (c *Caller) expires(h http.Header) time.Time {
+	t, err := http.ParseTime(h.Get("Expires"))
+	if err != nil {
+		return c.clock()
+	}
+	return t
+}
+
+// statusError classifies the failed response resp by its status code. MET
+// Norway answers clients breaking its terms, like missing User-Agent or too
+// many decimals, with 403 Forbidden.
+func statusError(resp *http.Response, u url.URL) error {
+	return aggregator.StatusError(ProviderName, resp, u.String(), nil)
+}
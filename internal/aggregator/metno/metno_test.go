@@ -0,0 +1,306 @@
+package metno_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/aggregatortest"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/fake"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/metno"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+const userAgent = "weather-forecast-aggregator-test"
+
+// TestConformance runs the conformance suite against the fake MET Norway
+// server.
+func TestConformance(t *testing.T) {
+	srv := fake.NewMETNorway(t)
+	aggregatortest.Run(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			sut, err := metno.DebuggingCaller(userAgent, srv.BaseURL(), client, time.Now)
+			if err != nil {
+				t.Fatalf("creating DebuggingCaller: %+v", err)
+			}
+			return sut
+		},
+		Upstream: srv.Client().Transport,
+	})
+}
+
+// TestTermsOfService verifies the requests identify the caller and don't ask
+// for more than 4 decimals of the coordinates.
+func TestTermsOfService(t *testing.T) {
+	srv := fake.NewMETNorway(t)
+	sut, err := metno.DebuggingCaller(userAgent, srv.BaseURL(), srv.Client(), time.Now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+
+	_, err = sut.AggregateWeather(context.Background(), types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 3})
+	if err != nil {
+		t.Fatalf("aggregate: %+v", err)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("Aggregation must send a single request, got %d", len(reqs))
+	}
+	if got := reqs[0].UserAgent(); got != userAgent {
+		t.Errorf("Request must identify with %q, got %q", userAgent, got)
+	}
+	if got, want := reqs[0].URL.RawQuery, "lat=42.6493&lon=-8.8201"; got != want {
+		t.Errorf("Request must truncate the coordinates to %q, got %q", want, got)
+	}
+}
+
+// TestCaching verifies responses are reused until they expire and only
+// revalidated afterwards.
+func TestCaching(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2024, 11, 5, 12, 10, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	srv := fake.NewMETNorway(t)
+	srv.SetClock(clock)
+	sut, err := metno.DebuggingCaller(userAgent, srv.BaseURL(), srv.Client(), clock)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+
+	q := types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 3}
+	first, err := sut.AggregateWeather(context.Background(), q)
+	if err != nil {
+		t.Fatalf("first aggregate: %+v", err)
+	}
+
+	tests := []struct {
+		name     string
+		advance  time.Duration
+		requests int
+		since    string
+		// reused tells whether the first response is still in use.
+		reused bool
+	}{
+		{name: "fresh", advance: 10 * time.Minute, requests: 1, reused: true},
+		{name: "not modified", advance: 30 * time.Minute, requests: 2, since: "Tue, 05 Nov 2024 12:00:00 GMT", reused: true},
+		{name: "modified", advance: 40 * time.Minute, requests: 3, since: "Tue, 05 Nov 2024 12:00:00 GMT"},
+	}
+	for _, tc := range tests {
+		advance(tc.advance)
+
+		got, err := sut.AggregateWeather(context.Background(), q)
+		if err != nil {
+			t.Fatalf("%s: aggregate: %+v", tc.name, err)
+		}
+		if tc.reused && !cmp.Equal(first, got) {
+			fmt.Println(cmp.Diff(first, got))
+			t.Errorf("%s: output mismatch, see diff", tc.name)
+		}
+
+		reqs := srv.Requests()
+		if len(reqs) != tc.requests {
+			t.Fatalf("%s: want %d requests, got %d", tc.name, tc.requests, len(reqs))
+		}
+		if got := reqs[len(reqs)-1].Header.Get("If-Modified-Since"); got != tc.since {
+			t.Errorf("%s: want If-Modified-Since %q, got %q", tc.name, tc.since, got)
+		}
+	}
+}
+
+type daysTestValues struct {
+	name     string
+	body     string
+	lat, lon float64
+	want     types.DailyForecast
+}
+
+// TestDays verifies the timeseries is summed up per day in the timezone of the
+// location, counting the precipitation of the hourly and the 6-hourly periods
+// once. The temperature extremes of the 6-hourly periods count, the ones of
+// the hourly steps are covered by their instants.
+func TestDays(t *testing.T) {
+	rr := []daysTestValues{
+		{
+			name: "instants",
+			body: `{"type":"Feature","properties":{"timeseries":[
+				{"time":"2024-11-05T22:00:00Z","data":{
+					"instant":{"details":{"air_temperature":10,"relative_humidity":80,"wind_speed":5,"wind_from_direction":270}},
+					"next_1_hours":{"summary":{"symbol_code":"lightrain"},"details":{"precipitation_amount":0.5}},
+					"next_6_hours":{"summary":{"symbol_code":"heavyrain"},"details":{"precipitation_amount":3}}}},
+				{"time":"2024-11-05T23:00:00Z","data":{
+					"instant":{"details":{"air_temperature":8,"relative_humidity":90,"wind_speed":5,"wind_from_direction":270}},
+					"next_1_hours":{"summary":{"symbol_code":"rain"},"details":{"precipitation_amount":0.5}},
+					"next_6_hours":{"summary":{"symbol_code":"heavyrain"},"details":{"precipitation_amount":3}}}},
+				{"time":"2024-11-06T00:00:00Z","data":{
+					"instant":{"details":{"air_temperature":7,"relative_humidity":70,"wind_speed":2,"wind_from_direction":0}},
+					"next_6_hours":{"summary":{"symbol_code":"cloudy"},"details":{"precipitation_amount":1.2}}}},
+				{"time":"2024-11-06T06:00:00Z","data":{
+					"instant":{"details":{"air_temperature":12,"relative_humidity":80,"wind_speed":2,"wind_from_direction":90}},
+					"next_6_hours":{"summary":{"symbol_code":"partlycloudy_day"},"details":{"precipitation_amount":0.8}}}}
+			]}}`,
+			lat: 51.4779,
+			lon: 0,
+			want: types.DailyForecast{
+				{
+					Date:             "2024-11-05",
+					MaxTemp:          10,
+					MinTemp:          8,
+					PrecipitationSum: 1,
+					MaxWindSpeed:     18,
+					WindDirection:    270,
+					RelativeHumidity: 85,
+					Condition:        types.ConditionRain,
+				},
+				{
+					Date:             "2024-11-06",
+					MaxTemp:          12,
+					MinTemp:          7,
+					PrecipitationSum: 2,
+					MaxWindSpeed:     7.2,
+					WindDirection:    45,
+					RelativeHumidity: 75,
+					Condition:        types.ConditionOvercast,
+				},
+			},
+		},
+		{
+			name: "6-hourly extremes",
+			body: `{"type":"Feature","properties":{"timeseries":[
+				{"time":"2024-11-05T22:00:00Z","data":{
+					"instant":{"details":{"air_temperature":10,"relative_humidity":80,"wind_speed":5,"wind_from_direction":270}},
+					"next_1_hours":{"summary":{"symbol_code":"lightrain"},"details":{"precipitation_amount":0.5}},
+					"next_6_hours":{"summary":{"symbol_code":"heavyrain"},"details":{"precipitation_amount":3,"air_temperature_max":30,"air_temperature_min":-5}}}},
+				{"time":"2024-11-05T23:00:00Z","data":{
+					"instant":{"details":{"air_temperature":8,"relative_humidity":90,"wind_speed":5,"wind_from_direction":270}},
+					"next_1_hours":{"summary":{"symbol_code":"rain"},"details":{"precipitation_amount":0.5}},
+					"next_6_hours":{"summary":{"symbol_code":"heavyrain"},"details":{"precipitation_amount":3,"air_temperature_max":30,"air_temperature_min":-5}}}},
+				{"time":"2024-11-06T00:00:00Z","data":{
+					"instant":{"details":{"air_temperature":7,"relative_humidity":70,"wind_speed":2,"wind_from_direction":0}},
+					"next_6_hours":{"summary":{"symbol_code":"cloudy"},"details":{"precipitation_amount":1.2,"air_temperature_max":9.5,"air_temperature_min":4.1}}}},
+				{"time":"2024-11-06T06:00:00Z","data":{
+					"instant":{"details":{"air_temperature":12,"relative_humidity":80,"wind_speed":2,"wind_from_direction":90}},
+					"next_6_hours":{"summary":{"symbol_code":"partlycloudy_day"},"details":{"precipitation_amount":0.8,"air_temperature_max":15.3,"air_temperature_min":6}}}}
+			]}}`,
+			lat: 51.4779,
+			lon: 0,
+			want: types.DailyForecast{
+				{
+					Date:             "2024-11-05",
+					MaxTemp:          10,
+					MinTemp:          8,
+					PrecipitationSum: 1,
+					MaxWindSpeed:     18,
+					WindDirection:    270,
+					RelativeHumidity: 85,
+					Condition:        types.ConditionRain,
+				},
+				{
+					Date:             "2024-11-06",
+					MaxTemp:          15.3,
+					MinTemp:          4.1,
+					PrecipitationSum: 2,
+					MaxWindSpeed:     7.2,
+					WindDirection:    45,
+					RelativeHumidity: 75,
+					Condition:        types.ConditionOvercast,
+				},
+			},
+		},
+		{
+			// Midnight in Madrid is 23:00 UTC in winter, the solar time of
+			// Galicia would start the day two hours later.
+			name: "Galicia",
+			body: `{"type":"Feature","properties":{"timeseries":[
+				{"time":"2024-11-05T22:00:00Z","data":{
+					"instant":{"details":{"air_temperature":10,"relative_humidity":80,"wind_speed":5,"wind_from_direction":270}},
+					"next_1_hours":{"summary":{"symbol_code":"lightrain"},"details":{"precipitation_amount":0.5}}}},
+				{"time":"2024-11-05T23:00:00Z","data":{
+					"instant":{"details":{"air_temperature":8,"relative_humidity":90,"wind_speed":5,"wind_from_direction":270}},
+					"next_1_hours":{"summary":{"symbol_code":"rain"},"details":{"precipitation_amount":0.5}}}},
+				{"time":"2024-11-06T00:00:00Z","data":{
+					"instant":{"details":{"air_temperature":7,"relative_humidity":70,"wind_speed":5,"wind_from_direction":270}},
+					"next_1_hours":{"summary":{"symbol_code":"cloudy"},"details":{"precipitation_amount":0}}}}
+			]}}`,
+			lat: 42.6493,
+			lon: -8.8201,
+			want: types.DailyForecast{
+				{
+					Date:             "2024-11-05",
+					MaxTemp:          10,
+					MinTemp:          10,
+					PrecipitationSum: 0.5,
+					MaxWindSpeed:     18,
+					WindDirection:    270,
+					RelativeHumidity: 80,
+					Condition:        types.ConditionLightRain,
+				},
+				{
+					Date:             "2024-11-06",
+					MaxTemp:          8,
+					MinTemp:          7,
+					PrecipitationSum: 0.5,
+					MaxWindSpeed:     18,
+					WindDirection:    270,
+					RelativeHumidity: 80,
+					Condition:        types.ConditionRain,
+				},
+			},
+		},
+	}
+
+	now := func() time.Time {
+		return time.Date(2024, 11, 5, 21, 30, 0, 0, time.UTC)
+	}
+	for _, r := range rr {
+		t.Run(r.name, func(t *testing.T) {
+			client := aggregatortest.Respond(http.StatusOK, nil, r.body)
+			sut, err := metno.DebuggingCaller(userAgent, nil, client, now)
+			if err != nil {
+				t.Fatalf("creating DebuggingCaller: %+v", err)
+			}
+
+			got, err := sut.AggregateWeather(context.Background(), types.Query{
+				Lat:  r.lat,
+				Lon:  r.lon,
+				Days: 2,
+				Variables: []types.Variable{
+					types.VarMaxTemp, types.VarMinTemp, types.VarPrecipitationSum, types.VarMaxWindSpeed,
+					types.VarWindDirection, types.VarRelativeHumidity, types.VarCondition,
+				},
+			})
+			if err != nil {
+				t.Fatalf("aggregate: %+v", err)
+			}
+
+			if !cmp.Equal(r.want, got) {
+				fmt.Println(cmp.Diff(r.want, got))
+				t.Error("output mismatch, see diff")
+			}
+		})
+	}
+}
+
+// TestMissingUserAgent verifies the caller refuses to work anonymously.
+func TestMissingUserAgent(t *testing.T) {
+	_, err := metno.DebuggingCaller("", nil, &http.Client{}, time.Now)
+	if !errors.Is(err, metno.ErrNoUserAgent) {
+		t.Errorf("Missing User-Agent must return ErrNoUserAgent, got %+v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package metno
+
+import (
+	"math"
+	"time"
+
+	// The zones must not depend on the zoneinfo of the host.
+	_ "time/tzdata"
+)
+
+// zones outlines the timezones of Iberia, where the regional providers like
+// MeteoGalicia work, so MET Norway agrees with them on the days. The boxes are
+// coarse, the first one holding the location wins. So Portugal comes before
+// the box of Spain that covers it as well.
+var zones = []struct {
+	name                     string
+	south, west, north, east float64
+}{
+	{name: "Atlantic/Canary", south: 27.5, west: -18.3, north: 29.5, east: -13.3},
+	{name: "Atlantic/Madeira", south: 32.3, west: -17.4, north: 33.2, east: -16.2},
+	{name: "Europe/Lisbon", south: 36.9, west: -9.6, north: 42.2, east: -7.4},
+	{name: "Europe/Madrid", south: 35.9, west: -9.4, north: 43.9, east: 4.4},
+}
+
+// zoneOf returns the timezone of the location. Outside of the known zones it
+// falls back to the solar time of the longitude, one hour per 15°, which misses
+// daylight saving time and political borders.
+func zoneOf(lat, lon float64) *time.Location {
+	for _, z := range zones {
+		if lat < z.south || lat > z.north || lon < z.west || lon > z.east {
+			continue
+		}
+		if loc, err := time.LoadLocation(z.name); err == nil {
+			return loc
+		}
+	}
+	return time.FixedZone("", int(math.Round(lon/15))*3600)
+}
@@ -0,0 +1,49 @@
+package openmeteo
+
+import "github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+
+// wmoConditions maps the WMO weather interpretation codes OpenMeteo uses for
+// its `weather_code` onto the canonical conditions.
+// See the bottom of https://open-meteo.com/en/docs for the code table.
+var wmoConditions = map[int]types.Condition{
+	0:  types.ConditionClear,
+	1:  types.ConditionClear,
+	2:  types.ConditionPartlyCloudy,
+	3:  types.ConditionOvercast,
+	45: types.ConditionFog,
+	48: types.ConditionFog,
+	51: types.ConditionLightDrizzle,
+	53: types.ConditionDrizzle,
+	55: types.ConditionDrizzle,
+	56: types.ConditionFreezingDrizzle,
+	57: types.ConditionFreezingDrizzle,
+	61: types.ConditionLightRain,
+	63: types.ConditionRain,
+	65: types.ConditionHeavyRain,
+	66: types.ConditionFreezingRain,
+	67: types.ConditionFreezingRain,
+	71: types.ConditionLightSnow,
+	73: types.ConditionSnow,
+	75: types.ConditionHeavySnow,
+	77: types.ConditionSnow,
+	80: types.ConditionRainShowers,
+	81: types.ConditionRainShowers,
+	82: types.ConditionHeavyRain,
+	85: types.ConditionSnowShowers,
+	86: types.ConditionSnowShowers,
+	95: types.ConditionThunderstorm,
+	96: types.ConditionThunderstormHail,
+	99: types.ConditionThunderstormHail,
+}
+
+// conditionAt maps the WMO code at index i onto the canonical condition.
+// A missing code, i.e. if it wasn't requested, results in an empty condition.
+func conditionAt(codes []int, i int) types.Condition {
+	if i >= len(codes) {
+		return ""
+	}
+	if c, ok := wmoConditions[codes[i]]; ok {
+		return c
+	}
+	return types.ConditionUnknown
+}
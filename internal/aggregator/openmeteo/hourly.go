@@ -0,0 +1,109 @@
+package openmeteo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// hourlyWrapper reflects the top level object of the hourly API response.
+type hourlyWrapper struct {
+	Hourly hourlyForecast `json:"hourly"`
+}
+
+// hourlyForecast reflects the hourly data of the API response.
+// Like the daily data it comes as arrays parallel to Time.
+type hourlyForecast struct {
+	Time                     []string  `json:"time"`
+	Temp                     []float32 `json:"temperature_2m"`
+	Precipitation            []float32 `json:"precipitation"`
+	PrecipitationProbability []float32 `json:"precipitation_probability"`
+	WindSpeed                []float32 `json:"wind_speed_10m"`
+	WindGust                 []float32 `json:"wind_gusts_10m"`
+	WindDirection            []float32 `json:"wind_direction_10m"`
+	CloudCover               []float32 `json:"cloud_cover"`
+	WeatherCode              []int     `json:"weather_code"`
+}
+
+// hourlyParams lists the `hourly` values in the order of types.HourForecast.
+const hourlyParams = "temperature_2m,precipitation,precipitation_probability," +
+	"wind_speed_10m,wind_gusts_10m,wind_direction_10m,cloud_cover,weather_code"
+
+// AggregateHourly implements the api.HourlyAggregator interface for the
+// OpenMeteo API. Other than the daily values the whole horizon is fetched with
+// a single request.
+func (c Caller) AggregateHourly(ctx context.Context, q types.Query) (types.HourlyForecast, error) {
+	if q.Hours > maxForecastDays*24 {
+		return nil, &aggregator.HorizonError{
+			Provider:  ProviderName,
+			Max:       maxForecastDays * 24,
+			Requested: q.Hours,
+			Unit:      "hours",
+		}
+	}
+
+	u := c.hourlyURL(q.Hours, q.Lat, q.Lon)
+
+	var tmp hourlyWrapper
+	if err := c.fetch(ctx, u, &tmp); err != nil {
+		return nil, aggregator.Failed(ctx, ProviderName, err)
+	}
+
+	h := tmp.Hourly
+	if err := h.validate(q.Hours); err != nil {
+		return nil, &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     aggregator.KindDecode,
+			Err:      fmt.Errorf("Invalid response data from %s: %w", u.String(), err),
+		}
+	}
+
+	res := make(types.HourlyForecast, 0, len(h.Time))
+	for i := range h.Time {
+		res = append(res, types.HourForecast{
+			Time:                     h.Time[i],
+			Temp:                     valueAt(h.Temp, i),
+			Precipitation:            valueAt(h.Precipitation, i),
+			PrecipitationProbability: valueAt(h.PrecipitationProbability, i),
+			WindSpeed:                valueAt(h.WindSpeed, i),
+			WindGust:                 valueAt(h.WindGust, i),
+			WindDirection:            valueAt(h.WindDirection, i),
+			CloudCover:               valueAt(h.CloudCover, i),
+			Condition:                conditionAt(h.WeatherCode, i),
+		})
+	}
+	return res, nil
+}
+
+// validate checks the response holds `hours` hours and that every variable in
+// it comes with one value per hour.
+func (f hourlyForecast) validate(hours int) error {
+	n := len(f.Time)
+	if n < hours {
+		return fmt.Errorf("received %d of %d hourly forecasts", n, hours)
+	}
+
+	return errors.Join(
+		sameLength("temperature_2m", f.Temp, n),
+		sameLength("precipitation", f.Precipitation, n),
+		sameLength("precipitation_probability", f.PrecipitationProbability, n),
+		sameLength("wind_speed_10m", f.WindSpeed, n),
+		sameLength("wind_gusts_10m", f.WindGust, n),
+		sameLength("wind_direction_10m", f.WindDirection, n),
+		sameLength("cloud_cover", f.CloudCover, n),
+		sameLength("weather_code", f.WeatherCode, n),
+	)
+}
+
+// hourlyURL generates the API endpoint URL for `hours` hourly forecasts,
+// starting with the current hour in the timezone of the location.
+func (c Caller) hourlyURL(hours int, lat, lon float64) url.URL {
+	return c.endpoint(fmt.Sprintf(
+		"latitude=%.6f&longitude=%.6f&forecast_hours=%d&timezone=auto&hourly=%s",
+		lat, lon, hours, hourlyParams,
+	))
+}
@@ -5,45 +5,52 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
-	"golang.org/x/sync/errgroup"
 )
 
 // Caller shall implement the api.Aggregator interface to call the OpenMeteo API.
 type Caller struct {
 	clock  func() time.Time
-	ctx    context.Context
 	client *http.Client
+	base   url.URL
 }
 
-// NewCaller creates a pre-configured OpenMeteo API caller.
-func NewCaller() *Caller {
+// DefaultBaseURL is where the public OpenMeteo API lives.
+const DefaultBaseURL = "https://api.open-meteo.com"
+
+// NewCaller creates a pre-configured OpenMeteo API caller, which retries failed
+// calls according to the policy retry. A nil base calls the DefaultBaseURL.
+func NewCaller(base *url.URL, retry aggregator.RetryPolicy) *Caller {
 	return DebuggingCaller(
-		context.Background(),
-		&http.Client{},
+		base,
+		aggregator.NewClient(retry),
 		time.Now,
 	)
 }
 
 // DebuggingCaller let define some specific types for the internal structure.
-// This makes it useful for testing or debugging sessions.
-func DebuggingCaller(ctx context.Context, client *http.Client, tf func() time.Time) *Caller {
+// This makes it useful for testing or debugging sessions, i.e. with the base
+// URL of a httptest.Server. A nil base calls the DefaultBaseURL.
+func DebuggingCaller(base *url.URL, client *http.Client, tf func() time.Time) *Caller {
 	if client == nil {
 		// It is said to be bad style panicking out of a package. I agree.
 		// Since we're inside of the business layer and introducing an error for one
 		// constructor that's supposed to be used only by developers I think it's fine
 		panic(errors.New("http client is required for configured caller as we do http requests"))
 	}
+	if base == nil {
+		base, _ = url.Parse(DefaultBaseURL)
+	}
 	return &Caller{
 		clock:  tf,
-		ctx:    ctx,
 		client: client,
+		base:   *base,
 	}
 }
 
@@ -54,120 +61,216 @@ type wrapper struct {
 }
 
 // forecast reflects the forecast data of the API response.
+// Each variable comes as an array parallel to Time. Variables that weren't
+// requested are missing in the response and stay nil.
 type forecast struct {
-	Time    []string  `json:"time"`
-	MaxTemp []float32 `json:"temperature_2m_max"`
+	Time                     []string  `json:"time"`
+	MaxTemp                  []float32 `json:"temperature_2m_max"`
+	MinTemp                  []float32 `json:"temperature_2m_min"`
+	PrecipitationSum         []float32 `json:"precipitation_sum"`
+	PrecipitationProbability []float32 `json:"precipitation_probability_max"`
+	MaxWindSpeed             []float32 `json:"wind_speed_10m_max"`
+	MaxWindGust              []float32 `json:"wind_gusts_10m_max"`
+	WindDirection            []float32 `json:"wind_direction_10m_dominant"`
+	RelativeHumidity         []float32 `json:"relative_humidity_2m_mean"`
+	UVIndex                  []float32 `json:"uv_index_max"`
+	Sunrise                  []string  `json:"sunrise"`
+	Sunset                   []string  `json:"sunset"`
+	WeatherCode              []int     `json:"weather_code"`
 }
 
-const daysToFetch int = 5
+// dailyParams maps our variables to the names of the OpenMeteo `daily` values.
+// The default units of OpenMeteo already match the ones of types.Forecast.
+var dailyParams = map[types.Variable]string{
+	types.VarMaxTemp:                  "temperature_2m_max",
+	types.VarMinTemp:                  "temperature_2m_min",
+	types.VarPrecipitationSum:         "precipitation_sum",
+	types.VarPrecipitationProbability: "precipitation_probability_max",
+	types.VarMaxWindSpeed:             "wind_speed_10m_max",
+	types.VarMaxWindGust:              "wind_gusts_10m_max",
+	types.VarWindDirection:            "wind_direction_10m_dominant",
+	types.VarRelativeHumidity:         "relative_humidity_2m_mean",
+	types.VarUVIndex:                  "uv_index_max",
+	types.VarSunrise:                  "sunrise",
+	types.VarSunset:                   "sunset",
+	types.VarCondition:                "weather_code",
+}
 
-// AggegrateWeather implements the api.Aggregator interface for the OpenMeteo API
-func (c Caller) AggregateWeather(lat, lon float64) (types.FiveDayForecast, error) {
-	results := make(chan types.Forecast)
-
-	g := new(errgroup.Group)
-	requestUrls := urlsToFetchIncluding(c.clock(), daysToFetch, lat, lon)
-
-	// First error-prone go routine:
-	// Request one URL after the other and put the result into the results channel
-	g.Go(func() error {
-		defer close(results)
-		for _, u := range requestUrls {
-			resp, err := c.client.Get(u.String())
-			if err != nil {
-				return fmt.Errorf("Get %s failed: %w", u.String(), err)
-			}
-
-			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf(
-					"GET %s unexpected status, want %d, got %d",
-					u.String(), http.StatusOK, resp.StatusCode,
-				)
-			}
-
-			bb, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return fmt.Errorf(
-					"Reads response data from %s failed: %w",
-					u.String(), err,
-				)
-			}
-
-			var tmp wrapper
-			if err = json.Unmarshal(bb, &tmp); err != nil {
-				return fmt.Errorf(
-					"Unmarshal response data from %s failed: %w",
-					u.String(), err,
-				)
-			}
-
-			d := tmp.Daily.Time[0]
-			t := tmp.Daily.MaxTemp[0]
-			res := types.Forecast{Date: d, MaxTemp: t}
-
-			results <- res
-		}
-		return nil
-	})
-
-	// error groups work like wait groups: They wait until the provided function
-	// returns. In addition they keep track of all errors that occured.
-	go func() {
-		if err := g.Wait(); err != nil {
-			slog.Default().Info("Downloading data failed.", slog.Any("err", err))
+// dailyParamsFor lists the `daily` values to request for the query.
+// MaxTemp is always requested so the response carries the time array anyway.
+func dailyParamsFor(q types.Query) string {
+	res := make([]string, 0, len(types.AllVariables))
+	for _, v := range types.AllVariables {
+		if v == types.VarMaxTemp || q.Wants(v) {
+			res = append(res, dailyParams[v])
 		}
-	}()
+	}
+	return strings.Join(res, ",")
+}
+
+// day converts the values at index i into the exchange format.
+func (f forecast) day(i int) types.Forecast {
+	return types.Forecast{
+		Date:                     valueAt(f.Time, i),
+		MaxTemp:                  valueAt(f.MaxTemp, i),
+		MinTemp:                  valueAt(f.MinTemp, i),
+		PrecipitationSum:         valueAt(f.PrecipitationSum, i),
+		PrecipitationProbability: valueAt(f.PrecipitationProbability, i),
+		MaxWindSpeed:             valueAt(f.MaxWindSpeed, i),
+		MaxWindGust:              valueAt(f.MaxWindGust, i),
+		WindDirection:            valueAt(f.WindDirection, i),
+		RelativeHumidity:         valueAt(f.RelativeHumidity, i),
+		UVIndex:                  valueAt(f.UVIndex, i),
+		Sunrise:                  valueAt(f.Sunrise, i),
+		Sunset:                   valueAt(f.Sunset, i),
+		Condition:                conditionAt(f.WeatherCode, i),
+	}
+}
+
+// validate checks the response holds `days` days and that every variable in it
+// comes with one value per day, so the values can't end up on the wrong day.
+func (f forecast) validate(days int) error {
+	n := len(f.Time)
+	if n != days {
+		return fmt.Errorf("received %d of %d forecasts", n, days)
+	}
+
+	return errors.Join(
+		sameLength("temperature_2m_max", f.MaxTemp, n),
+		sameLength("temperature_2m_min", f.MinTemp, n),
+		sameLength("precipitation_sum", f.PrecipitationSum, n),
+		sameLength("precipitation_probability_max", f.PrecipitationProbability, n),
+		sameLength("wind_speed_10m_max", f.MaxWindSpeed, n),
+		sameLength("wind_gusts_10m_max", f.MaxWindGust, n),
+		sameLength("wind_direction_10m_dominant", f.WindDirection, n),
+		sameLength("relative_humidity_2m_mean", f.RelativeHumidity, n),
+		sameLength("uv_index_max", f.UVIndex, n),
+		sameLength("sunrise", f.Sunrise, n),
+		sameLength("sunset", f.Sunset, n),
+		sameLength("weather_code", f.WeatherCode, n),
+	)
+}
+
+// sameLength reports an error if the variable `name` is in the response but
+// doesn't hold n values. Variables that weren't requested are nil.
+func sameLength[T any](name string, vv []T, n int) error {
+	if vv != nil && len(vv) != n {
+		return fmt.Errorf("%s holds %d values, want %d", name, len(vv), n)
+	}
+	return nil
+}
+
+// valueAt returns the element at index i or the zero value for variables that
+// are missing in the response.
+func valueAt[T any](vv []T, i int) T {
+	var empty T
+	if i >= len(vv) {
+		return empty
+	}
+	return vv[i]
+}
+
+// maxForecastDays is the longest daily forecast OpenMeteo serves.
+const maxForecastDays = 16
 
-	var res types.FiveDayForecast
-	// Second Go Routine converting the downloaded results into the exchange format
-	// with 5 forecasts in one struct.
-	g.Go(func() error {
-		rr := make([]types.Forecast, 0, 5)
+// ProviderName identifies this provider in errors and in the provider registry.
+const ProviderName = "openmeteo"
+
+// DisplayName, Attribution and AttributionURL credit OpenMeteo next to its
+// forecasts, as its CC BY 4.0 license requires.
+const (
+	DisplayName    = "Open-Meteo"
+	Attribution    = "Weather data by Open-Meteo.com (CC BY 4.0)"
+	AttributionURL = "https://open-meteo.com/"
+)
 
-		for r := range results {
-			rr = append(rr, r)
+// AggegrateWeather implements the api.Aggregator interface for the OpenMeteo API
+// The whole horizon is fetched with a single request for the date range.
+func (c Caller) AggregateWeather(ctx context.Context, q types.Query) (types.DailyForecast, error) {
+	if q.Days > maxForecastDays {
+		return nil, &aggregator.HorizonError{
+			Provider:  ProviderName,
+			Max:       maxForecastDays,
+			Requested: q.Days,
+			Unit:      "days",
 		}
+	}
 
-		res.Day1 = types.Forecast{Date: rr[0].Date, MaxTemp: rr[0].MaxTemp}
-		res.Day2 = types.Forecast{Date: rr[1].Date, MaxTemp: rr[1].MaxTemp}
-		res.Day3 = types.Forecast{Date: rr[2].Date, MaxTemp: rr[2].MaxTemp}
-		res.Day4 = types.Forecast{Date: rr[3].Date, MaxTemp: rr[3].MaxTemp}
-		res.Day5 = types.Forecast{Date: rr[4].Date, MaxTemp: rr[4].MaxTemp}
+	u := c.rangeURL(c.clock(), q.Days, q.Lat, q.Lon, dailyParamsFor(q))
 
-		return nil
-	})
+	var tmp wrapper
+	if err := c.fetch(ctx, u, &tmp); err != nil {
+		return nil, aggregator.Failed(ctx, ProviderName, err)
+	}
 
-	// Synchronously wait for all downloaded data to be converted.
-	if err := g.Wait(); err != nil {
-		slog.Default().Error("Converting failed.", slog.Any("err", err))
+	if err := tmp.Daily.validate(q.Days); err != nil {
+		return nil, &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     aggregator.KindDecode,
+			Err:      fmt.Errorf("Invalid response data from %s: %w", u.String(), err),
+		}
 	}
 
+	res := make(types.DailyForecast, 0, len(tmp.Daily.Time))
+	for i := range tmp.Daily.Time {
+		day := tmp.Daily.day(i)
+		if !q.Wants(types.VarMaxTemp) {
+			day.MaxTemp = 0
+		}
+		res = append(res, day)
+	}
 	return res, nil
 }
 
-// urlsToFetchIncluding helps to generate the requested amount of API endpoint
-// URLs with the provided start date `d`, counting one day up `amount` times.
-func urlsToFetchIncluding(d time.Time, amount int, lat, lon float64) []url.URL {
-	res := make([]url.URL, 0, amount)
+// MaxForecastDays implements the api.Aggregator interface and reports how many
+// days ahead the API is able to forecast.
+func (c Caller) MaxForecastDays() int {
+	return maxForecastDays
+}
 
-	latest := d
+// rangeURL generates the API endpoint URL for `amount` days of forecasts,
+// starting with the date `d`.
+// The `daily` values are requested in the timezone of the location, so days and
+// sunrise or sunset times are local.
+func (c Caller) rangeURL(d time.Time, amount int, lat, lon float64, daily string) url.URL {
+	first := d.Format(time.DateOnly)
+	last := d.AddDate(0, 0, amount-1).Format(time.DateOnly)
 
-	for i := 0; i < amount; i++ {
-		date := latest.Format(time.DateOnly)
+	return c.endpoint(fmt.Sprintf(
+		"latitude=%.6f&longitude=%.6f&start_date=%s&end_date=%s&timezone=auto&daily=%s",
+		lat, lon, first, last, daily,
+	))
+}
 
-		u := url.URL{
-			Scheme: "https",
-			Host:   "api.open-meteo.com",
-			Path:   "/v1/forecast",
-			RawQuery: fmt.Sprintf(
-				"latitude=%.6f&longitude=%.6f&start_date=%s&end_date=%s&daily=temperature_2m_max",
-				lat, lon, date, date,
-			),
-		}
-		res = append(res, u)
+// endpoint returns the URL of the forecast endpoint below the base URL with
+// the query.
+func (c Caller) endpoint(query string) url.URL {
+	res := c.base.JoinPath("v1", "forecast")
+	res.RawQuery = query
+	return *res
+}
 
-		latest = latest.AddDate(0, 0, 1)
+// apiError is the body OpenMeteo answers failed requests with.
+type apiError struct {
+	Reason string `json:"reason"`
+}
+
+// classify explains failed responses by their body. OpenMeteo tells about
+// coordinates it doesn't cover in bad requests.
+func classify(status int, body []byte) (aggregator.Kind, string) {
+	var res apiError
+	// The reason only adds details, so a body that doesn't fit is fine.
+	_ = json.Unmarshal(body, &res)
+
+	reason := strings.ToLower(res.Reason)
+	if status == http.StatusBadRequest &&
+		(strings.Contains(reason, "latitude") || strings.Contains(reason, "longitude")) {
+		return aggregator.KindInvalidLocation, res.Reason
 	}
+	return "", res.Reason
+}
 
-	return res
+// fetch unmarshals the JSON response of the URL u into v.
+func (c Caller) fetch(ctx context.Context, u url.URL, v any) error {
+	return aggregator.FetchJSON(ctx, c.client, ProviderName, u, "", classify, v)
 }
@@ -2,32 +2,45 @@ package openmeteo_test
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/aggregatortest"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/fake"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/openmeteo"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/replay"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
 )
 
-// TestOpenMeteoAggregation_HistoricalData uses the side effect of historical
-// data on the forecast endpoint of OpenMeteo.
-// By requesting data from the past it is unlikely that the forecast will change.
-//
-// There might be an issue with time that dates before the historical data.
-func TestOpenMeteoAggregation_HistoricalData(t *testing.T) {
+// TestOpenMeteoAggregation_FixedData runs against the fake OpenMeteo server,
+// so the forecast neither changes nor needs the internet.
+func TestOpenMeteoAggregation_FixedData(t *testing.T) {
 	lat, lon := 42.6493934, -8.8201753
 
 	ctx, cancel := context.WithCancel(context.Background())
 	t.Cleanup(cancel)
 
-	// Technical Debt: This runs a test with the default HTTP client against the
-	// real endpoint.
-	// Using an net/httptest server for reproducable responses would be better.
-	// Currently the historical data is still fetched, so it looks good enough.
-	sut := openmeteo.DebuggingCaller(ctx, &http.Client{}, func() time.Time {
+	srv := fake.NewOpenMeteo(t)
+	srv.SetDays(
+		fake.Day{MaxTemp: 14.6},
+		fake.Day{MaxTemp: 14.9},
+		fake.Day{MaxTemp: 18.2},
+		fake.Day{MaxTemp: 21.2},
+		fake.Day{MaxTemp: 22.3},
+	)
+
+	sut := openmeteo.DebuggingCaller(srv.BaseURL(), srv.Client(), func() time.Time {
 		res, err := time.Parse(time.DateOnly, "2024-10-25")
 		if err != nil {
 			t.Fatalf("Cannot test hard-coded past value, got %+v", err)
@@ -35,7 +48,12 @@ func TestOpenMeteoAggregation_HistoricalData(t *testing.T) {
 		return res
 	})
 
-	got, err := sut.AggregateWeather(lat, lon)
+	got, err := sut.AggregateWeather(ctx, types.Query{
+		Lat:       lat,
+		Lon:       lon,
+		Days:      5,
+		Variables: []types.Variable{types.VarMaxTemp},
+	})
 	if err != nil {
 		t.Fatalf(
 			"Error while aggregate from OpenMeteo for lat %.8f, lon %.8f, got: %+v",
@@ -43,14 +61,328 @@ func TestOpenMeteoAggregation_HistoricalData(t *testing.T) {
 		)
 	}
 
-	want := types.FiveDayForecast{
-		Day1: types.Forecast{Date: "2024-10-25", MaxTemp: 14.6},
-		Day2: types.Forecast{Date: "2024-10-26", MaxTemp: 14.9},
-		Day3: types.Forecast{Date: "2024-10-27", MaxTemp: 18.2},
-		Day4: types.Forecast{Date: "2024-10-28", MaxTemp: 21.2},
-		Day5: types.Forecast{Date: "2024-10-29", MaxTemp: 22.3},
+	want := types.DailyForecast{
+		{Date: "2024-10-25", MaxTemp: 14.6},
+		{Date: "2024-10-26", MaxTemp: 14.9},
+		{Date: "2024-10-27", MaxTemp: 18.2},
+		{Date: "2024-10-28", MaxTemp: 21.2},
+		{Date: "2024-10-29", MaxTemp: 22.3},
+	}
+
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+// record refreshes the fixtures in testdata from the real API, i.e.
+// go test ./internal/aggregator/openmeteo -record
+var record = flag.Bool("record", false, "record the fixtures from the upstream API")
+
+// TestOpenMeteoAggregation_Fixture replays a real response from testdata, so it
+// catches changes in the format once the fixture is recorded again.
+func TestOpenMeteoAggregation_Fixture(t *testing.T) {
+	mode := replay.ModeReplay
+	if *record {
+		mode = replay.ModeRecord
+	}
+	client := &http.Client{Transport: replay.NewTransport(nil, replay.Config{Dir: "testdata", Mode: mode})}
+
+	sut := openmeteo.DebuggingCaller(nil, client, func() time.Time {
+		return time.Date(2024, 10, 25, 12, 0, 0, 0, time.UTC)
+	})
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:       42.6493934,
+		Lon:       -8.8201753,
+		Days:      5,
+		Variables: []types.Variable{types.VarMaxTemp},
+	})
+	if err != nil {
+		t.Fatalf("aggregate: %+v", err)
+	}
+
+	want := types.DailyForecast{
+		{Date: "2024-10-25", MaxTemp: 14.6},
+		{Date: "2024-10-26", MaxTemp: 14.9},
+		{Date: "2024-10-27", MaxTemp: 18.2},
+		{Date: "2024-10-28", MaxTemp: 21.2},
+		{Date: "2024-10-29", MaxTemp: 22.3},
+	}
+
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+// TestOpenMeteoAggregation_Conformance runs the conformance suite against the
+// fake OpenMeteo server.
+func TestOpenMeteoAggregation_Conformance(t *testing.T) {
+	srv := fake.NewOpenMeteo(t)
+	aggregatortest.Run(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			return openmeteo.DebuggingCaller(srv.BaseURL(), client, time.Now)
+		},
+		Upstream: srv.Client().Transport,
+	})
+}
+
+// TestOpenMeteoAggregation_SlowResponse verifies a response that takes longer
+// than the caller waits ends up as a timeout.
+func TestOpenMeteoAggregation_SlowResponse(t *testing.T) {
+	srv := fake.NewOpenMeteo(t)
+	srv.Enqueue(fake.Response{Delay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	t.Cleanup(cancel)
+
+	sut := openmeteo.DebuggingCaller(srv.BaseURL(), srv.Client(), time.Now)
+	_, err := sut.AggregateWeather(ctx, types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 3})
+
+	var cErr *aggregator.CanceledError
+	if !errors.As(err, &cErr) || !cErr.Timeout() {
+		t.Errorf("Slow response must time out, got %+v", err)
+	}
+}
+
+// TestOpenMeteoAggregation_CanceledContext verifies a cancelled request does not
+// reach out to the API and reports the typed cancellation error.
+func TestOpenMeteoAggregation_CanceledContext(t *testing.T) {
+	lat, lon := 42.6493934, -8.8201753
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sut := openmeteo.DebuggingCaller(nil, &http.Client{}, time.Now)
+
+	_, err := sut.AggregateWeather(ctx, types.Query{
+		Lat:       lat,
+		Lon:       lon,
+		Days:      5,
+		Variables: []types.Variable{types.VarMaxTemp},
+	})
+
+	var cErr *aggregator.CanceledError
+	if !errors.As(err, &cErr) {
+		t.Fatalf("Cancelled context must return *aggregator.CanceledError, got %+v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancellation error must unwrap to context.Canceled, got %+v", err)
+	}
+}
+
+// TestOpenMeteoAggregation_BeyondHorizon verifies queries beyond the 16 days of
+// OpenMeteo are rejected before any request leaves the caller.
+func TestOpenMeteoAggregation_BeyondHorizon(t *testing.T) {
+	sut := openmeteo.DebuggingCaller(nil, &http.Client{}, time.Now)
+
+	q := types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: sut.MaxForecastDays() + 1}
+	_, err := sut.AggregateWeather(context.Background(), q)
+
+	var hErr *aggregator.HorizonError
+	if !errors.As(err, &hErr) {
+		t.Fatalf("Query beyond horizon must return *aggregator.HorizonError, got %+v", err)
+	}
+	if hErr.Max != 16 {
+		t.Errorf("OpenMeteo horizon mismatch, want 16, got %d", hErr.Max)
+	}
+}
+
+// cannedClient answers every request with the JSON body and counts the
+// requests it received.
+func cannedClient(body string, requests *[]*http.Request) *http.Client {
+	return &http.Client{Transport: aggregatortest.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		*requests = append(*requests, r)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+}
+
+// TestOpenMeteoAggregation_SingleRangedRequest verifies the whole horizon is
+// fetched with one request and every day of the arrays is decoded.
+func TestOpenMeteoAggregation_SingleRangedRequest(t *testing.T) {
+	body := `{"daily":{
+		"time":["2024-10-25","2024-10-26","2024-10-27"],
+		"temperature_2m_max":[14.6,14.9,18.2],
+		"temperature_2m_min":[8.1,9.3,11.0]
+	}}`
+
+	var requests []*http.Request
+	sut := openmeteo.DebuggingCaller(nil, cannedClient(body, &requests), func() time.Time {
+		return time.Date(2024, 10, 25, 12, 0, 0, 0, time.UTC)
+	})
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:       42.6493934,
+		Lon:       -8.8201753,
+		Days:      3,
+		Variables: []types.Variable{types.VarMaxTemp, types.VarMinTemp},
+	})
+	if err != nil {
+		t.Fatalf("Aggregate canned response failed, got %+v", err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("Horizon must be fetched with a single request, got %d", len(requests))
+	}
+	params := requests[0].URL.Query()
+	if params.Get("start_date") != "2024-10-25" || params.Get("end_date") != "2024-10-27" {
+		t.Errorf("Request must cover the horizon, got %s", requests[0].URL.RawQuery)
+	}
+
+	want := types.DailyForecast{
+		{Date: "2024-10-25", MaxTemp: 14.6, MinTemp: 8.1},
+		{Date: "2024-10-26", MaxTemp: 14.9, MinTemp: 9.3},
+		{Date: "2024-10-27", MaxTemp: 18.2, MinTemp: 11.0},
+	}
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+type mismatchTestValues struct {
+	name string
+	body string
+}
+
+// TestOpenMeteoAggregation_MismatchingArrays verifies responses with arrays of
+// different lengths are rejected instead of mixing up the days.
+func TestOpenMeteoAggregation_MismatchingArrays(t *testing.T) {
+	rr := []mismatchTestValues{
+		{
+			name: "short variable",
+			body: `{"daily":{"time":["2024-10-25","2024-10-26"],"temperature_2m_max":[14.6]}}`,
+		},
+		{
+			name: "long variable",
+			body: `{"daily":{"time":["2024-10-25","2024-10-26"],"temperature_2m_max":[14.6,14.9,18.2]}}`,
+		},
+		{
+			name: "missing days",
+			body: `{"daily":{"time":["2024-10-25"],"temperature_2m_max":[14.6]}}`,
+		},
+		{
+			name: "empty",
+			body: `{"daily":{}}`,
+		},
+	}
+
+	for _, r := range rr {
+		t.Run(r.name, func(t *testing.T) {
+			var requests []*http.Request
+			sut := openmeteo.DebuggingCaller(nil, cannedClient(r.body, &requests), time.Now)
+
+			got, err := sut.AggregateWeather(context.Background(), types.Query{
+				Lat:  42.6493934,
+				Lon:  -8.8201753,
+				Days: 2,
+			})
+			var pErr *aggregator.ProviderError
+			if !errors.As(err, &pErr) {
+				t.Errorf("Mismatching arrays must return *aggregator.ProviderError, got %+v and %+v", got, err)
+			}
+		})
+	}
+}
+
+// TestOpenMeteoAggregation_UpstreamFailure verifies failing upstream calls are
+// reported as typed errors for the daily and the hourly forecasts.
+func TestOpenMeteoAggregation_UpstreamFailure(t *testing.T) {
+	sut := openmeteo.DebuggingCaller(nil, aggregatortest.Respond(http.StatusBadGateway, nil, "Bad Gateway"), time.Now)
+	q := types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 5, Hours: 48}
+
+	got, err := sut.AggregateWeather(context.Background(), q)
+	var pErr *aggregator.ProviderError
+	if !errors.As(err, &pErr) {
+		t.Errorf("Failing upstream must return *aggregator.ProviderError, got %+v and %+v", got, err)
+	}
+
+	hours, err := sut.AggregateHourly(context.Background(), q)
+	if !errors.As(err, &pErr) {
+		t.Errorf("Failing upstream must return *aggregator.ProviderError for hours, got %+v and %+v", hours, err)
+	}
+}
+
+// TestOpenMeteoAggregation_ShortHourlyArrays verifies hourly responses with
+// missing values fail instead of panicking or reporting zeros.
+func TestOpenMeteoAggregation_ShortHourlyArrays(t *testing.T) {
+	body := `{"hourly":{"time":["2024-10-25T10:00","2024-10-25T11:00"],"temperature_2m":[14.6]}}`
+
+	var requests []*http.Request
+	sut := openmeteo.DebuggingCaller(nil, cannedClient(body, &requests), time.Now)
+
+	got, err := sut.AggregateHourly(context.Background(), types.Query{
+		Lat:   42.6493934,
+		Lon:   -8.8201753,
+		Hours: 2,
+	})
+	var pErr *aggregator.ProviderError
+	if !errors.As(err, &pErr) {
+		t.Errorf("Short arrays must return *aggregator.ProviderError, got %+v and %+v", got, err)
+	}
+}
+
+// TestOpenMeteoAggregation_ErrorKinds verifies failures are classified, so the
+// API can tell an outage apart from a location OpenMeteo doesn't cover.
+func TestOpenMeteoAggregation_ErrorKinds(t *testing.T) {
+	aggregatortest.RunErrorKinds(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			return openmeteo.DebuggingCaller(nil, client, time.Now)
+		},
+	}, []aggregatortest.ErrorCase{
+		{
+			Name:       "rate limited",
+			Status:     http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": {"60"}},
+			Body:       `{"error":true,"reason":"Minutely API request limit exceeded."}`,
+			Kind:       aggregator.KindRateLimited,
+			RetryAfter: time.Minute,
+		},
+		{
+			Name:   "invalid location",
+			Status: http.StatusBadRequest,
+			Body:   `{"error":true,"reason":"Latitude must be in range of -90 to 90°. Given: 91.0."}`,
+			Kind:   aggregator.KindInvalidLocation,
+		},
+	})
+}
+
+// TestOpenMeteoAggregation_BaseURL verifies the caller talks to a configured
+// stand-in below its path prefix instead of the public API.
+func TestOpenMeteoAggregation_BaseURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mirror/v1/forecast" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"daily":{"time":["2024-10-25"],"temperature_2m_max":[14.6]}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	base, err := url.Parse(srv.URL + "/mirror")
+	if err != nil {
+		t.Fatalf("parse base URL: %+v", err)
+	}
+	sut := openmeteo.DebuggingCaller(base, srv.Client(), func() time.Time {
+		return time.Date(2024, 10, 25, 12, 0, 0, 0, time.UTC)
+	})
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:  42.6493934,
+		Lon:  -8.8201753,
+		Days: 1,
+	})
+	if err != nil {
+		t.Fatalf("Aggregate from stand-in failed, got %+v", err)
 	}
 
+	want := types.DailyForecast{{Date: "2024-10-25", MaxTemp: 14.6}}
 	if !cmp.Equal(want, got) {
 		fmt.Println(cmp.Diff(want, got))
 		t.Error("output mismatch, see diff")
@@ -0,0 +1,66 @@
+package openweathermap
+
+import "github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+
+// codeConditions maps the OpenWeatherMap `weather.id` values onto the canonical
+// conditions. The texts are the ones OpenWeatherMap documents.
+// See https://openweathermap.org/weather-conditions
+var codeConditions = map[int]types.Condition{
+	200: types.ConditionThunderstorm, // Thunderstorm with light rain
+	201: types.ConditionThunderstorm, // Thunderstorm with rain
+	202: types.ConditionThunderstorm, // Thunderstorm with heavy rain
+	210: types.ConditionThunderstorm, // Light thunderstorm
+	211: types.ConditionThunderstorm, // Thunderstorm
+	212: types.ConditionThunderstorm, // Heavy thunderstorm
+	221: types.ConditionThunderstorm, // Ragged thunderstorm
+	230: types.ConditionThunderstorm, // Thunderstorm with light drizzle
+	231: types.ConditionThunderstorm, // Thunderstorm with drizzle
+	232: types.ConditionThunderstorm, // Thunderstorm with heavy drizzle
+	300: types.ConditionLightDrizzle, // Light intensity drizzle
+	301: types.ConditionDrizzle,      // Drizzle
+	302: types.ConditionDrizzle,      // Heavy intensity drizzle
+	310: types.ConditionLightDrizzle, // Light intensity drizzle rain
+	311: types.ConditionDrizzle,      // Drizzle rain
+	312: types.ConditionDrizzle,      // Heavy intensity drizzle rain
+	313: types.ConditionRainShowers,  // Shower rain and drizzle
+	314: types.ConditionRainShowers,  // Heavy shower rain and drizzle
+	321: types.ConditionRainShowers,  // Shower drizzle
+	500: types.ConditionLightRain,    // Light rain
+	501: types.ConditionRain,         // Moderate rain
+	502: types.ConditionHeavyRain,    // Heavy intensity rain
+	503: types.ConditionHeavyRain,    // Very heavy rain
+	504: types.ConditionHeavyRain,    // Extreme rain
+	511: types.ConditionFreezingRain, // Freezing rain
+	520: types.ConditionRainShowers,  // Light intensity shower rain
+	521: types.ConditionRainShowers,  // Shower rain
+	522: types.ConditionRainShowers,  // Heavy intensity shower rain
+	531: types.ConditionRainShowers,  // Ragged shower rain
+	600: types.ConditionLightSnow,    // Light snow
+	601: types.ConditionSnow,         // Snow
+	602: types.ConditionHeavySnow,    // Heavy snow
+	611: types.ConditionSleet,        // Sleet
+	612: types.ConditionSleet,        // Light shower sleet
+	613: types.ConditionSleet,        // Shower sleet
+	615: types.ConditionSleet,        // Light rain and snow
+	616: types.ConditionSleet,        // Rain and snow
+	620: types.ConditionSnowShowers,  // Light shower snow
+	621: types.ConditionSnowShowers,  // Shower snow
+	622: types.ConditionSnowShowers,  // Heavy shower snow
+	701: types.ConditionFog,          // Mist
+	711: types.ConditionFog,          // Smoke
+	721: types.ConditionFog,          // Haze
+	741: types.ConditionFog,          // Fog
+	800: types.ConditionClear,        // Clear sky
+	801: types.ConditionPartlyCloudy, // Few clouds: 11-25%
+	802: types.ConditionPartlyCloudy, // Scattered clouds: 25-50%
+	803: types.ConditionCloudy,       // Broken clouds: 51-84%
+	804: types.ConditionOvercast,     // Overcast clouds: 85-100%
+}
+
+// conditionOf maps the `weather.id` onto the canonical condition.
+func conditionOf(id int) types.Condition {
+	if res, ok := codeConditions[id]; ok {
+		return res
+	}
+	return types.ConditionUnknown
+}
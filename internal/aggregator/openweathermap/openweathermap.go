@@ -0,0 +1,294 @@
+package openweathermap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// Caller shall implement the api.Aggregator interface to call the
+// OpenWeatherMap 5 day / 3 hour forecast API.
+type Caller struct {
+	client *http.Client
+	apikey string
+	clock  func() time.Time
+	base   url.URL
+}
+
+// DefaultBaseURL is where the OpenWeatherMap API lives.
+const DefaultBaseURL = "https://api.openweathermap.org"
+
+// NewCaller creates a pre-configured caller that uses the provided API key and
+// retries failed calls according to the policy retry.
+// A nil base calls the DefaultBaseURL.
+func NewCaller(apikey string, base *url.URL, retry aggregator.RetryPolicy) (*Caller, error) {
+	return DebuggingCaller(apikey, base, aggregator.NewClient(retry), time.Now)
+}
+
+// DebuggingCaller lets inject non-default implementation for testing and
+// debugging sessions, i.e. the base URL of a httptest.Server.
+// A nil base calls the DefaultBaseURL.
+func DebuggingCaller(key string, base *url.URL, c *http.Client, cf func() time.Time) (*Caller, error) {
+	if key == "" {
+		return nil, aggregator.ErrNoApiKeyProvided
+	}
+	if base == nil {
+		base, _ = url.Parse(DefaultBaseURL)
+	}
+	return &Caller{
+		apikey: key,
+		client: c,
+		clock:  cf,
+		base:   *base,
+	}, nil
+}
+
+// maxForecastDays follows the free forecast, which covers the next 120 hours.
+// They touch 5 local days if they start early enough, the last one cut short.
+const maxForecastDays = 5
+
+// ProviderName identifies this provider in errors and in the provider registry.
+const ProviderName = "openweathermap"
+
+// DisplayName, Attribution and AttributionURL credit OpenWeatherMap next to its
+// forecasts, as its CC BY-SA 4.0 license requires.
+const (
+	DisplayName    = "OpenWeatherMap"
+	Attribution    = "Weather data provided by OpenWeather (CC BY-SA 4.0)"
+	AttributionURL = "https://openweathermap.org/"
+)
+
+// wrapper is the top level object of the API response.
+type wrapper struct {
+	List []entry `json:"list"`
+	City city    `json:"city"`
+}
+
+// city describes the location. Timezone is its shift from UTC in seconds,
+// sunrise and sunset are the ones of today as Unix time.
+type city struct {
+	Timezone int   `json:"timezone"`
+	Sunrise  int64 `json:"sunrise"`
+	Sunset   int64 `json:"sunset"`
+}
+
+// entry holds the forecast of 3 hours, starting at Dt in Unix time.
+// Wind speeds are in m/s even with metric units, the probability of
+// precipitation Pop is a fraction.
+type entry struct {
+	Dt   int64 `json:"dt"`
+	Main struct {
+		Temp     float32 `json:"temp"`
+		TempMin  float32 `json:"temp_min"`
+		TempMax  float32 `json:"temp_max"`
+		Humidity float32 `json:"humidity"`
+	} `json:"main"`
+	Weather []struct {
+		ID int `json:"id"`
+	} `json:"weather"`
+	Wind struct {
+		Speed float32 `json:"speed"`
+		Deg   float32 `json:"deg"`
+		Gust  float32 `json:"gust"`
+	} `json:"wind"`
+	Pop  float32 `json:"pop"`
+	Rain struct {
+		ThreeHours float32 `json:"3h"`
+	} `json:"rain"`
+	Snow struct {
+		ThreeHours float32 `json:"3h"`
+	} `json:"snow"`
+}
+
+// AggregateWeather implements the api.Aggregator interface on Caller.
+// All entries come with a single request and are grouped into days in the
+// timezone of the location, starting with today or, late in the evening, with
+// tomorrow.
+func (c *Caller) AggregateWeather(ctx context.Context, q types.Query) (types.DailyForecast, error) {
+	if q.Days > maxForecastDays {
+		return nil, &aggregator.HorizonError{
+			Provider:  ProviderName,
+			Max:       maxForecastDays,
+			Requested: q.Days,
+			Unit:      "days",
+		}
+	}
+
+	u := c.forecastURL(q.Lat, q.Lon)
+
+	var tmp wrapper
+	if err := c.fetch(ctx, u, &tmp); err != nil {
+		return nil, aggregator.Failed(ctx, ProviderName, err)
+	}
+
+	zone := time.FixedZone("", tmp.City.Timezone)
+	days := group(tmp.List, zone)
+	if err := contiguous(days, c.clock().In(zone), q.Days); err != nil {
+		return nil, &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     aggregator.KindDecode,
+			Err:      fmt.Errorf("Invalid response data from %s: %w", aggregator.Redacted(u, "appid"), err),
+		}
+	}
+
+	res := make(types.DailyForecast, 0, q.Days)
+	for _, d := range days[:q.Days] {
+		res = append(res, d.toForecast(q, tmp.City, zone))
+	}
+	return res, nil
+}
+
+// MaxForecastDays implements the api.Aggregator interface and reports how many
+// days ahead the API is able to forecast.
+func (c *Caller) MaxForecastDays() int {
+	return maxForecastDays
+}
+
+// Variables implements the api.VariableAggregator interface. The free forecast
+// has no UV index.
+func (c *Caller) Variables() []types.Variable {
+	return []types.Variable{
+		types.VarMaxTemp, types.VarMinTemp, types.VarPrecipitationSum,
+		types.VarPrecipitationProbability, types.VarMaxWindSpeed, types.VarMaxWindGust,
+		types.VarWindDirection, types.VarRelativeHumidity, types.VarSunrise,
+		types.VarSunset, types.VarCondition,
+	}
+}
+
+// day holds the entries of a single local day.
+type day struct {
+	date    string
+	entries []entry
+}
+
+// group sorts the entries into local days. The API returns them in order, so
+// the days are in order, too.
+func group(ee []entry, zone *time.Location) []day {
+	var res []day
+	for _, e := range ee {
+		date := time.Unix(e.Dt, 0).In(zone).Format(time.DateOnly)
+		if len(res) == 0 || res[len(res)-1].date != date {
+			res = append(res, day{date: date})
+		}
+		res[len(res)-1].entries = append(res[len(res)-1].entries, e)
+	}
+	return res
+}
+
+// contiguous checks the response holds `days` days, each one following the
+// day before. The list starts with the next 3 hours, so after the last ones of
+// the local day it starts with tomorrow instead of today.
+func contiguous(dd []day, today time.Time, days int) error {
+	if len(dd) < days {
+		return fmt.Errorf("received %d of %d forecasts", len(dd), days)
+	}
+
+	first := today
+	if tomorrow := today.AddDate(0, 0, 1); len(dd) > 0 && dd[0].date == tomorrow.Format(time.DateOnly) {
+		first = tomorrow
+	}
+	for i, d := range dd[:days] {
+		if want := first.AddDate(0, 0, i).Format(time.DateOnly); d.date != want {
+			return fmt.Errorf("day %d is %s, want %s", i, d.date, want)
+		}
+	}
+	return nil
+}
+
+// toForecast summarizes the entries of the day into the exchange format, only
+// filling the values the query asked for. OpenWeatherMap has no UV index, and
+// sunrise and sunset only for today, so they stay empty on the other days.
+func (d day) toForecast(q types.Query, c city, zone *time.Location) types.Forecast {
+	res := types.Forecast{Date: d.date}
+
+	var humidity float64
+	winds := make([]aggregator.Wind, 0, len(d.entries))
+	conditions := make([]types.Condition, 0, len(d.entries))
+	for i, e := range d.entries {
+		if i == 0 || e.Main.TempMax > res.MaxTemp {
+			res.MaxTemp = e.Main.TempMax
+		}
+		if i == 0 || e.Main.TempMin < res.MinTemp {
+			res.MinTemp = e.Main.TempMin
+		}
+		res.PrecipitationSum += e.Rain.ThreeHours + e.Snow.ThreeHours
+		res.PrecipitationProbability = max(res.PrecipitationProbability, e.Pop*100)
+		res.MaxWindSpeed = max(res.MaxWindSpeed, e.Wind.Speed*aggregator.MsToKmh)
+		res.MaxWindGust = max(res.MaxWindGust, e.Wind.Gust*aggregator.MsToKmh)
+		humidity += float64(e.Main.Humidity)
+		winds = append(winds, aggregator.Wind{Speed: e.Wind.Speed, Direction: e.Wind.Deg})
+		for _, w := range e.Weather {
+			conditions = append(conditions, conditionOf(w.ID))
+		}
+	}
+	res.RelativeHumidity = float32(math.Round(humidity / float64(len(d.entries))))
+	res.PrecipitationSum = float32(math.Round(float64(res.PrecipitationSum)*10) / 10)
+	res.MaxWindSpeed = float32(math.Round(float64(res.MaxWindSpeed)*10) / 10)
+	res.MaxWindGust = float32(math.Round(float64(res.MaxWindGust)*10) / 10)
+	res.WindDirection = aggregator.DominantDirection(winds)
+
+	res.Sunrise = localTime(c.Sunrise, zone, d.date)
+	res.Sunset = localTime(c.Sunset, zone, d.date)
+	res.Condition = aggregator.WorstCondition(conditions)
+
+	return aggregator.Filter(res, q)
+}
+
+// localTime returns the Unix time ts as ISO 8601 local time, if it's on the
+// date.
+func localTime(ts int64, zone *time.Location, date string) string {
+	if ts == 0 {
+		return ""
+	}
+	t := time.Unix(ts, 0).In(zone)
+	if t.Format(time.DateOnly) != date {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04")
+}
+
+// forecastURL generates the API endpoint URL of the forecast at the location.
+// Temperatures come in °C with metric units.
+func (c *Caller) forecastURL(lat, lon float64) url.URL {
+	res := c.base.JoinPath("data", "2.5", "forecast")
+	res.RawQuery = fmt.Sprintf(
+		"lat=%f&lon=%f&units=metric&appid=%s",
+		lat, lon, c.apikey,
+	)
+	return *res
+}
+
+// apiError is the body OpenWeatherMap answers failed requests with. Its `cod`
+// comes as number or string depending on the endpoint, so it's left out.
+type apiError struct {
+	Message string `json:"message"`
+}
+
+// classify explains failed responses by their body. OpenWeatherMap tells about
+// coordinates it doesn't cover in bad requests.
+func classify(status int, body []byte) (aggregator.Kind, string) {
+	var res apiError
+	// The message only adds details, so a body that doesn't fit is fine.
+	_ = json.Unmarshal(body, &res)
+
+	msg := strings.ToLower(res.Message)
+	if status == http.StatusBadRequest &&
+		(strings.Contains(msg, "latitude") || strings.Contains(msg, "longitude")) {
+		return aggregator.KindInvalidLocation, res.Message
+	}
+	return "", res.Message
+}
+
+// fetch unmarshals the JSON response of the URL u into v. The key travels as
+// appid.
+func (c *Caller) fetch(ctx context.Context, u url.URL, v any) error {
+	return aggregator.FetchJSON(ctx, c.client, ProviderName, u, "appid", classify, v)
+}
@@ -0,0 +1,178 @@
+package openweathermap_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/aggregatortest"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/fake"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/openweathermap"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// TestConformance runs the conformance suite against the fake OpenWeatherMap
+// server.
+func TestConformance(t *testing.T) {
+	srv := fake.NewOpenWeatherMap(t, "secret")
+	aggregatortest.Run(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			sut, err := openweathermap.DebuggingCaller("secret", srv.BaseURL(), client, time.Now)
+			if err != nil {
+				t.Fatalf("creating DebuggingCaller: %+v", err)
+			}
+			return sut
+		},
+		Upstream: srv.Client().Transport,
+		Secret:   "secret",
+	})
+}
+
+// TestLocalDays verifies the 3-hourly entries are grouped into days in the
+// timezone of the location instead of UTC, with the values summed up per day.
+func TestLocalDays(t *testing.T) {
+	// New York in winter, 5 hours behind UTC.
+	body := `{"cod":"200","cnt":8,"list":[
+		{"dt":1730808000,"main":{"temp_min":10,"temp_max":10,"humidity":60},"weather":[{"id":800}],"wind":{"speed":2,"deg":90,"gust":4},"pop":0},
+		{"dt":1730818800,"main":{"temp_min":14,"temp_max":14,"humidity":50},"weather":[{"id":801}],"wind":{"speed":5,"deg":90,"gust":9},"pop":0},
+		{"dt":1730829600,"main":{"temp_min":18,"temp_max":18,"humidity":40},"weather":[{"id":803}],"wind":{"speed":4,"deg":90,"gust":7},"pop":0.2},
+		{"dt":1730840400,"main":{"temp_min":16,"temp_max":16,"humidity":50},"weather":[{"id":500}],"wind":{"speed":3,"deg":90,"gust":6},"pop":0.65,"rain":{"3h":0.4}},
+		{"dt":1730851200,"main":{"temp_min":12,"temp_max":12,"humidity":70},"weather":[{"id":501}],"wind":{"speed":2,"deg":90,"gust":5},"pop":0.5,"rain":{"3h":1.1}},
+		{"dt":1730862000,"main":{"temp_min":11,"temp_max":11,"humidity":80},"weather":[{"id":804}],"wind":{"speed":1,"deg":90,"gust":3},"pop":0.1},
+		{"dt":1730872800,"main":{"temp_min":9,"temp_max":9,"humidity":85},"weather":[{"id":804}],"wind":{"speed":1,"deg":180,"gust":2},"pop":0},
+		{"dt":1730883600,"main":{"temp_min":8,"temp_max":8,"humidity":85},"weather":[{"id":701}],"wind":{"speed":1,"deg":180,"gust":2},"pop":0}
+	],"city":{"timezone":-18000,"sunrise":1730806500,"sunset":1730844000}}`
+
+	now := func() time.Time {
+		return time.Date(2024, 11, 5, 12, 0, 0, 0, time.UTC)
+	}
+	sut, err := openweathermap.DebuggingCaller("secret", nil, aggregatortest.Respond(http.StatusOK, nil, body), now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:  40.7128,
+		Lon:  -74.006,
+		Days: 2,
+		Variables: []types.Variable{
+			types.VarMaxTemp, types.VarMinTemp, types.VarPrecipitationSum,
+			types.VarPrecipitationProbability, types.VarMaxWindSpeed, types.VarMaxWindGust,
+			types.VarWindDirection, types.VarRelativeHumidity, types.VarSunrise, types.VarCondition,
+		},
+	})
+	if err != nil {
+		t.Fatalf("aggregate: %+v", err)
+	}
+
+	want := types.DailyForecast{
+		{
+			Date:                     "2024-11-05",
+			MaxTemp:                  18,
+			MinTemp:                  10,
+			PrecipitationSum:         1.5,
+			PrecipitationProbability: 65,
+			MaxWindSpeed:             18,
+			MaxWindGust:              32.4,
+			WindDirection:            90,
+			RelativeHumidity:         58,
+			Sunrise:                  "2024-11-05T06:35",
+			Condition:                types.ConditionRain,
+		},
+		{
+			Date:             "2024-11-06",
+			MaxTemp:          9,
+			MinTemp:          8,
+			MaxWindSpeed:     3.6,
+			MaxWindGust:      7.2,
+			WindDirection:    180,
+			RelativeHumidity: 85,
+			Condition:        types.ConditionFog,
+		},
+	}
+
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+// TestLateEvening verifies the forecast starts with tomorrow once the list
+// does, after the last 3 hours of the local day started.
+func TestLateEvening(t *testing.T) {
+	now := func() time.Time {
+		return time.Date(2024, 11, 5, 22, 30, 0, 0, time.UTC)
+	}
+	srv := fake.NewOpenWeatherMap(t, "secret")
+	srv.SetClock(now)
+
+	sut, err := openweathermap.DebuggingCaller("secret", srv.BaseURL(), srv.Client(), now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:       42.6493934,
+		Lon:       -8.8201753,
+		Days:      5,
+		Variables: []types.Variable{types.VarMaxTemp},
+	})
+	if err != nil {
+		t.Fatalf("aggregate: %+v", err)
+	}
+
+	var dates []string
+	for _, f := range got {
+		dates = append(dates, f.Date)
+	}
+	want := []string{"2024-11-06", "2024-11-07", "2024-11-08", "2024-11-09", "2024-11-10"}
+	if !cmp.Equal(want, dates) {
+		fmt.Println(cmp.Diff(want, dates))
+		t.Error("dates mismatch, see diff")
+	}
+}
+
+// TestErrorKinds verifies failed calls are classified by their message and
+// responses missing days count as malformed.
+func TestErrorKinds(t *testing.T) {
+	now := func() time.Time {
+		return time.Date(2024, 11, 5, 12, 0, 0, 0, time.UTC)
+	}
+	aggregatortest.RunErrorKinds(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			sut, err := openweathermap.DebuggingCaller("secret", nil, client, now)
+			if err != nil {
+				t.Fatalf("creating DebuggingCaller: %+v", err)
+			}
+			return sut
+		},
+		Secret: "secret",
+	}, []aggregatortest.ErrorCase{
+		{
+			Name:   "wrong latitude",
+			Status: http.StatusBadRequest,
+			Body:   `{"cod":"400","message":"wrong latitude"}`,
+			Kind:   aggregator.KindInvalidLocation,
+		},
+		{
+			Name:   "short",
+			Status: http.StatusOK,
+			Body:   `{"list":[{"dt":1730808000}],"city":{"timezone":0}}`,
+			Kind:   aggregator.KindDecode,
+		},
+	})
+}
+
+// TestMissingKey verifies the caller refuses to work without an API key.
+func TestMissingKey(t *testing.T) {
+	_, err := openweathermap.DebuggingCaller("", nil, &http.Client{}, time.Now)
+	if !errors.Is(err, aggregator.ErrNoApiKeyProvided) {
+		t.Errorf("Missing key must return ErrNoApiKeyProvided, got %+v", err)
+	}
+}
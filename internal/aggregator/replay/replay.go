@@ -0,0 +1,234 @@
+/*
+Package replay records exchanges with upstream APIs into fixture files and
+serves them again later, so provider tests run offline against real responses.
+
+Tests inject the Transport with the callers' DebuggingCaller. Fixtures are
+refreshed on purpose by running the tests in record mode, i.e. once a provider
+changes its format:
+
+	go test ./internal/aggregator/openmeteo -record
+
+Secrets in the query, like the WeatherAPI key, are redacted before anything is
+written, so the fixtures can be committed. Parts of the bodies nobody reads,
+like the current weather, can be scrubbed as well, so a refresh only shows
+what matters.
+*/
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mode tells whether the Transport talks to the upstream API or not.
+type Mode int
+
+const (
+	// ModeReplay serves the exchanges from the fixtures and never touches the
+	// network.
+	ModeReplay Mode = iota
+	// ModeRecord forwards the requests upstream and saves the exchanges as
+	// fixtures, replacing older ones.
+	ModeRecord
+)
+
+// Redacted replaces the values of redacted query parameters.
+const Redacted = "REDACTED"
+
+// ErrNoFixture is reported in replay mode for requests that weren't recorded.
+var ErrNoFixture = errors.New("no fixture recorded")
+
+// Config holds the directory of the fixtures, usually "testdata", and the
+// query parameters to redact, like "key". Scrub, if set, rewrites the response
+// body before it is written, the caller still gets the original one.
+type Config struct {
+	Dir    string
+	Mode   Mode
+	Redact []string
+	Scrub  func(body []byte) []byte
+}
+
+// DropFields returns a scrubber that removes the top-level fields names from
+// JSON objects. Other bodies are kept as they are.
+func DropFields(names ...string) func([]byte) []byte {
+	return func(body []byte) []byte {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) != nil {
+			return body
+		}
+		for _, name := range names {
+			delete(fields, name)
+		}
+		bb, err := json.Marshal(fields)
+		if err != nil {
+			return body
+		}
+		return bb
+	}
+}
+
+// Transport is a http.RoundTripper that records or replays exchanges.
+type Transport struct {
+	next http.RoundTripper
+	cfg  Config
+}
+
+// NewTransport returns a Transport that records the exchanges with the
+// transport next, which defaults to http.DefaultTransport if nil. In replay
+// mode next isn't used at all.
+func NewTransport(next http.RoundTripper, cfg Config) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{next: next, cfg: cfg}
+}
+
+// fixture is the file format of a recorded exchange. JSON bodies are kept as
+// they are, so the fixtures diff nicely, other bodies as text.
+type fixture struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status int             `json:"status"`
+		Header http.Header     `json:"header,omitempty"`
+		JSON   json.RawMessage `json:"json,omitempty"`
+		Text   string          `json:"text,omitempty"`
+	} `json:"response"`
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cfg.Mode == ModeRecord {
+		return t.record(req)
+	}
+	return t.replay(req)
+}
+
+// replay answers the request with its fixture.
+func (t *Transport) replay(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	target := t.target(req)
+	bb, err := os.ReadFile(t.path(req.Method, target))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s %s, run in record mode", ErrNoFixture, req.Method, target)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read fixture: %w", err)
+	}
+
+	var f fixture
+	if err := json.Unmarshal(bb, &f); err != nil {
+		return nil, fmt.Errorf("unmarshal fixture for %s %s: %w", req.Method, target, err)
+	}
+
+	body := []byte(f.Response.Text)
+	if f.Response.JSON != nil {
+		body = f.Response.JSON
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Response.Status, http.StatusText(f.Response.Status)),
+		StatusCode:    f.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Response.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// record forwards the request upstream and saves the exchange.
+func (t *Transport) record(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read response to record: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if t.cfg.Scrub != nil {
+		body = t.cfg.Scrub(body)
+	}
+
+	var f fixture
+	f.Request.Method = req.Method
+	f.Request.URL = t.target(req)
+	f.Response.Status = resp.StatusCode
+	f.Response.Header = resp.Header.Clone()
+	// Varying with every call, these would make every refresh a diff.
+	for _, name := range []string{"Date", "Set-Cookie", "Content-Length"} {
+		f.Response.Header.Del(name)
+	}
+
+	var buf bytes.Buffer
+	if json.Indent(&buf, body, "", "  ") == nil {
+		f.Response.JSON = buf.Bytes()
+	} else {
+		f.Response.Text = string(body)
+	}
+
+	// Keeps the & of the URL readable.
+	var bb bytes.Buffer
+	enc := json.NewEncoder(&bb)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return nil, fmt.Errorf("marshal fixture: %w", err)
+	}
+	if err := os.MkdirAll(t.cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(t.path(req.Method, f.Request.URL), bb.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("write fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// target returns the path and query of the request with the secrets redacted
+// and the parameters sorted. Hosts are left out, so fixtures work with every
+// base URL.
+func (t *Transport) target(req *http.Request) string {
+	params := req.URL.Query()
+	for _, name := range t.cfg.Redact {
+		if params.Has(name) {
+			params.Set(name, Redacted)
+		}
+	}
+
+	res := req.URL.EscapedPath()
+	if len(params) > 0 {
+		res += "?" + params.Encode()
+	}
+	return res
+}
+
+// path returns the name of the fixture file of the request, made of its path
+// and a hash of method and target, like "testdata/v1_forecast-0123456789ab.json".
+func (t *Transport) path(method, target string) string {
+	sum := sha256.Sum256([]byte(method + " " + target))
+
+	p, _, _ := strings.Cut(target, "?")
+	name := strings.ReplaceAll(strings.Trim(p, "/"), "/", "_")
+	name = strings.ReplaceAll(name, ".", "_")
+	return filepath.Join(t.cfg.Dir, name+"-"+hex.EncodeToString(sum[:6])+".json")
+}
@@ -0,0 +1,130 @@
+package replay_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/fake"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/replay"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/weatherapi"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// TestRecordAndReplay records an exchange with the fake WeatherAPI and serves it
+// again after the server is gone, with another key even.
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	q := types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 3, Variables: []types.Variable{types.VarMaxTemp}}
+
+	srv := fake.NewWeatherAPI(t, "secret")
+	recorder := replay.NewTransport(srv.Client().Transport, replay.Config{
+		Dir:    dir,
+		Mode:   replay.ModeRecord,
+		Redact: []string{"key"},
+	})
+	sut, err := weatherapi.DebuggingCaller("secret", srv.BaseURL(), &http.Client{Transport: recorder}, time.Now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+	want, err := sut.AggregateWeather(context.Background(), q)
+	if err != nil {
+		t.Fatalf("aggregate while recording: %+v", err)
+	}
+	srv.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "v1_forecast_json-*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Recording must write a single fixture, got %v, %+v", files, err)
+	}
+	bb, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read fixture: %+v", err)
+	}
+	if strings.Contains(string(bb), "secret") {
+		t.Error("Fixture must not contain the API key")
+	}
+	if !strings.Contains(string(bb), "key="+replay.Redacted) {
+		t.Error("Fixture must contain the redacted API key")
+	}
+
+	player := replay.NewTransport(nil, replay.Config{Dir: dir, Redact: []string{"key"}})
+	sut, err = weatherapi.DebuggingCaller("another", srv.BaseURL(), &http.Client{Transport: player}, time.Now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+	got, err := sut.AggregateWeather(context.Background(), q)
+	if err != nil {
+		t.Fatalf("aggregate while replaying: %+v", err)
+	}
+
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+// TestRecord_Scrub verifies scrubbed fields stay out of the fixture, but not
+// out of the response.
+func TestRecord_Scrub(t *testing.T) {
+	dir := t.TempDir()
+	upstream := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"current":{"temp_c":15.2},"forecast":{}}`)),
+			Request:    req,
+		}, nil
+	}
+	recorder := replay.NewTransport(roundTripFunc(upstream), replay.Config{
+		Dir:   dir,
+		Mode:  replay.ModeRecord,
+		Scrub: replay.DropFields("current"),
+	})
+
+	resp, err := (&http.Client{Transport: recorder}).Get("https://api.weatherapi.com/v1/forecast.json")
+	if err != nil {
+		t.Fatalf("record: %+v", err)
+	}
+	bb, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(bb), "current") {
+		t.Errorf("Response must keep the scrubbed field, got %s", bb)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Recording must write a single fixture, got %v, %+v", files, err)
+	}
+	bb, err = os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read fixture: %+v", err)
+	}
+	if strings.Contains(string(bb), "current") || !strings.Contains(string(bb), "forecast") {
+		t.Errorf("Fixture must only lose the scrubbed field, got %s", bb)
+	}
+}
+
+// roundTripFunc turns a function into a http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestReplay_MissingFixture verifies requests that weren't recorded fail
+// instead of going upstream.
+func TestReplay_MissingFixture(t *testing.T) {
+	player := replay.NewTransport(nil, replay.Config{Dir: t.TempDir()})
+
+	_, err := (&http.Client{Transport: player}).Get("https://api.open-meteo.com/v1/forecast?latitude=1")
+	if !errors.Is(err, replay.ErrNoFixture) {
+		t.Errorf("Missing fixture must return replay.ErrNoFixture, got %+v", err)
+	}
+}
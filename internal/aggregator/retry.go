@@ -0,0 +1,160 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// RetryPolicy tells how often and how patiently failed upstream calls are
+// repeated. Every provider has its own, as their APIs differ in how they cope
+// with load.
+type RetryPolicy struct {
+	// Budget is the number of retries a single call may use up.
+	Budget int
+	// BaseDelay is the wait before the first retry, doubling with every further
+	// one.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between two attempts. Upstream APIs asking to wait
+	// longer via Retry-After are not retried at all.
+	MaxDelay time.Duration
+}
+
+// retryStatus lists the status codes of upstream hiccups that are likely gone
+// on the next attempt.
+var retryStatus = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryTransport is a http.RoundTripper that repeats idempotent requests after
+// transient failures, waiting exponentially longer with some jitter in between.
+// The jitter keeps clients that failed at the same time from coming back at the
+// same time, too.
+type RetryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+}
+
+// NewRetryTransport wraps the transport next, which defaults to
+// http.DefaultTransport if nil.
+func NewRetryTransport(next http.RoundTripper, p RetryPolicy) *RetryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RetryTransport{next: next, policy: p}
+}
+
+// NewClient returns a http.Client that retries according to the policy p.
+func NewClient(p RetryPolicy) *http.Client {
+	return &http.Client{Transport: NewRetryTransport(nil, p)}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+// Only requests without body or with a replayable one are retried, and only if
+// their method is idempotent.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !retryable(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		r, err := rewind(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.next.RoundTrip(r)
+		if attempt >= t.policy.Budget || !transient(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if resp != nil {
+			if ra := RetryAfter(resp.Header, time.Now()); ra > 0 {
+				if ra > t.policy.MaxDelay {
+					// Not worth waiting for, let the caller report it.
+					return resp, err
+				}
+				wait = max(wait, ra)
+			}
+			// Drain the body, so the connection can be reused.
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the wait before the retry following the attempt, which is
+// half the exponential delay plus a random share of the other half.
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	d := t.policy.BaseDelay << attempt
+	if d <= 0 || d > t.policy.MaxDelay {
+		d = t.policy.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryable tells if the request may be sent again without side effects.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewind returns the request for the attempt, with a fresh body for retries.
+func rewind(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// transient tells if the attempt failed in a way that's likely gone on the
+// next one. Errors that are classified already, like an exhausted quota, are
+// final.
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		var pErr *ProviderError
+		return !errors.As(err, &pErr)
+	}
+	return slices.Contains(retryStatus, resp.StatusCode)
+}
+
+// sleep waits for the duration d unless the context is done before.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,151 @@
+package aggregator_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+)
+
+// flakyServer fails the first `failures` requests with the status code and
+// counts all requests it received.
+func flakyServer(t *testing.T, failures int32, code int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			for k, vv := range header {
+				w.Header()[k] = vv
+			}
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+var fastPolicy = aggregator.RetryPolicy{
+	Budget:    2,
+	BaseDelay: time.Millisecond,
+	MaxDelay:  10 * time.Millisecond,
+}
+
+type retryTestValues struct {
+	name      string
+	failures  int32
+	code      int
+	method    string
+	wantCalls int32
+	wantCode  int
+}
+
+func TestRetryTransport(t *testing.T) {
+	rr := []retryTestValues{
+		{name: "transient 502", failures: 1, code: http.StatusBadGateway, method: http.MethodGet, wantCalls: 2, wantCode: http.StatusOK},
+		{name: "within budget", failures: 2, code: http.StatusServiceUnavailable, method: http.MethodGet, wantCalls: 3, wantCode: http.StatusOK},
+		{name: "budget exhausted", failures: 5, code: http.StatusBadGateway, method: http.MethodGet, wantCalls: 3, wantCode: http.StatusBadGateway},
+		{name: "permanent 401", failures: 1, code: http.StatusUnauthorized, method: http.MethodGet, wantCalls: 1, wantCode: http.StatusUnauthorized},
+		{name: "not idempotent", failures: 1, code: http.StatusBadGateway, method: http.MethodPost, wantCalls: 1, wantCode: http.StatusBadGateway},
+	}
+
+	for _, r := range rr {
+		t.Run(r.name, func(t *testing.T) {
+			srv, calls := flakyServer(t, r.failures, r.code, nil)
+			c := aggregator.NewClient(fastPolicy)
+
+			req, err := http.NewRequest(r.method, srv.URL, strings.NewReader(""))
+			if err != nil {
+				t.Fatalf("create request: %+v", err)
+			}
+
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatalf("Request must not fail, got %+v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != r.wantCode {
+				t.Errorf("Status mismatch, want %d, got %d", r.wantCode, resp.StatusCode)
+			}
+			if got := calls.Load(); got != r.wantCalls {
+				t.Errorf("Call count mismatch, want %d, got %d", r.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestRetryTransport_HonoursRetryAfter(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+	c := aggregator.NewClient(aggregator.RetryPolicy{
+		Budget:    1,
+		BaseDelay: time.Millisecond,
+		MaxDelay:  2 * time.Second,
+	})
+
+	start := time.Now()
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Request must not fail, got %+v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("Rate limited call must be retried, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+	if took := time.Since(start); took < time.Second {
+		t.Errorf("Retry must wait as asked by Retry-After, took %s", took)
+	}
+}
+
+func TestRetryTransport_RetryAfterBeyondMaxDelay(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"3600"}})
+	c := aggregator.NewClient(fastPolicy)
+
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Request must not fail, got %+v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests || calls.Load() != 1 {
+		t.Errorf("Long Retry-After must not be waited for, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestRetryTransport_StopsOnCancelledContext(t *testing.T) {
+	srv, calls := flakyServer(t, 5, http.StatusBadGateway, nil)
+	c := aggregator.NewClient(aggregator.RetryPolicy{
+		Budget:    5,
+		BaseDelay: time.Hour,
+		MaxDelay:  time.Hour,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("create request: %+v", err)
+	}
+
+	start := time.Now()
+	if resp, err := c.Do(req); err == nil {
+		resp.Body.Close()
+		t.Error("Cancelled retries must fail")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Cancelled retries must stop waiting, took %s", took)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Cancelled retries must not call again, got %d calls", got)
+	}
+}
@@ -0,0 +1,65 @@
+package weatherapi
+
+import "github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+
+// codeConditions maps the WeatherAPI `condition.code` values onto the canonical
+// conditions. The texts are the ones WeatherAPI documents for the day.
+// See https://www.weatherapi.com/docs/weather_conditions.json
+var codeConditions = map[int]types.Condition{
+	1000: types.ConditionClear,           // Sunny / Clear
+	1003: types.ConditionPartlyCloudy,    // Partly cloudy
+	1006: types.ConditionCloudy,          // Cloudy
+	1009: types.ConditionOvercast,        // Overcast
+	1030: types.ConditionFog,             // Mist
+	1063: types.ConditionLightRain,       // Patchy rain possible
+	1066: types.ConditionLightSnow,       // Patchy snow possible
+	1069: types.ConditionSleet,           // Patchy sleet possible
+	1072: types.ConditionFreezingDrizzle, // Patchy freezing drizzle possible
+	1087: types.ConditionThunderstorm,    // Thundery outbreaks possible
+	1114: types.ConditionSnow,            // Blowing snow
+	1117: types.ConditionHeavySnow,       // Blizzard
+	1135: types.ConditionFog,             // Fog
+	1147: types.ConditionFog,             // Freezing fog
+	1150: types.ConditionLightDrizzle,    // Patchy light drizzle
+	1153: types.ConditionLightDrizzle,    // Light drizzle
+	1168: types.ConditionFreezingDrizzle, // Freezing drizzle
+	1171: types.ConditionFreezingDrizzle, // Heavy freezing drizzle
+	1180: types.ConditionLightRain,       // Patchy light rain
+	1183: types.ConditionLightRain,       // Light rain
+	1186: types.ConditionRain,            // Moderate rain at times
+	1189: types.ConditionRain,            // Moderate rain
+	1192: types.ConditionHeavyRain,       // Heavy rain at times
+	1195: types.ConditionHeavyRain,       // Heavy rain
+	1198: types.ConditionFreezingRain,    // Light freezing rain
+	1201: types.ConditionFreezingRain,    // Moderate or heavy freezing rain
+	1204: types.ConditionSleet,           // Light sleet
+	1207: types.ConditionSleet,           // Moderate or heavy sleet
+	1210: types.ConditionLightSnow,       // Patchy light snow
+	1213: types.ConditionLightSnow,       // Light snow
+	1216: types.ConditionSnow,            // Patchy moderate snow
+	1219: types.ConditionSnow,            // Moderate snow
+	1222: types.ConditionHeavySnow,       // Patchy heavy snow
+	1225: types.ConditionHeavySnow,       // Heavy snow
+	1237: types.ConditionSleet,           // Ice pellets
+	1240: types.ConditionRainShowers,     // Light rain shower
+	1243: types.ConditionRainShowers,     // Moderate or heavy rain shower
+	1246: types.ConditionHeavyRain,       // Torrential rain shower
+	1249: types.ConditionSleet,           // Light sleet showers
+	1252: types.ConditionSleet,           // Moderate or heavy sleet showers
+	1255: types.ConditionSnowShowers,     // Light snow showers
+	1258: types.ConditionSnowShowers,     // Moderate or heavy snow showers
+	1261: types.ConditionSleet,           // Light showers of ice pellets
+	1264: types.ConditionSleet,           // Moderate or heavy showers of ice pellets
+	1273: types.ConditionThunderstorm,    // Patchy light rain with thunder
+	1276: types.ConditionThunderstorm,    // Moderate or heavy rain with thunder
+	1279: types.ConditionThunderstorm,    // Patchy light snow with thunder
+	1282: types.ConditionThunderstorm,    // Moderate or heavy snow with thunder
+}
+
+// conditionOf maps the WeatherAPI condition onto the canonical condition.
+func conditionOf(c condition) types.Condition {
+	if res, ok := codeConditions[c.Code]; ok {
+		return res
+	}
+	return types.ConditionUnknown
+}
@@ -0,0 +1,64 @@
+package weatherapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// AggregateHourly implements the api.HourlyAggregator interface on Caller.
+// WeatherAPI groups the hours by day, so it requests enough days to cover the
+// horizon from the current hour on and flattens them with a single request.
+func (c *Caller) AggregateHourly(ctx context.Context, q types.Query) (types.HourlyForecast, error) {
+	if q.Hours > maxForecastDays*24 {
+		return nil, &aggregator.HorizonError{
+			Provider:  ProviderName,
+			Max:       maxForecastDays * 24,
+			Requested: q.Hours,
+			Unit:      "hours",
+		}
+	}
+
+	// The current hour might be late in the day, so one more day is needed.
+	days := min((q.Hours+23)/24+1, maxForecastDays)
+	u := c.forecastURL(days, q.Lat, q.Lon)
+
+	var tmp wrapper
+	if err := c.fetch(ctx, u, &tmp); err != nil {
+		return nil, aggregator.Failed(ctx, ProviderName, err)
+	}
+
+	start := c.clock().Truncate(time.Hour).Unix()
+	res := make(types.HourlyForecast, 0, q.Hours)
+	for _, d := range tmp.Forecast.ForecastDay {
+		for _, h := range d.Hour {
+			if h.TimeEpoch < start || len(res) == q.Hours {
+				continue
+			}
+			res = append(res, types.HourForecast{
+				Time:                     strings.Replace(h.Time, " ", "T", 1),
+				Temp:                     h.TempC,
+				Precipitation:            h.PrecipMm,
+				PrecipitationProbability: h.ChanceOfRain,
+				WindSpeed:                h.WindKph,
+				WindGust:                 h.GustKph,
+				WindDirection:            h.WindDegree,
+				CloudCover:               h.Cloud,
+				Condition:                conditionOf(h.Condition),
+			})
+		}
+	}
+
+	if len(res) < q.Hours {
+		return nil, &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     aggregator.KindDecode,
+			Err:      fmt.Errorf("received %d of %d hourly forecasts", len(res), q.Hours),
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,245 @@
+package weatherapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+)
+
+// quotaRemaining publishes the calls left in the current quota period.
+var quotaRemaining = expvar.NewMap("quota_remaining")
+
+// Period is the time span a quota budget is granted for.
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+)
+
+// QuotaConfig holds the budget of calls per period the API key may use.
+// Once no more than Reserve calls are left, WeatherAPI isn't asked anymore,
+// so the key keeps some calls for the operators. File persists the counters,
+// an empty File keeps them in memory only. Flush is how long counted calls wait
+// to be written, so a burst of calls ends up in a single write.
+type QuotaConfig struct {
+	Budget  int
+	Period  Period
+	Reserve int
+	File    string
+	Flush   time.Duration
+}
+
+// usage counts the calls within a period, like "2024-11" for a month.
+type usage struct {
+	Period string `json:"period"`
+	Calls  int    `json:"calls"`
+}
+
+// Quota tracks the calls of an API key against its budget. As ADR-01 makes the
+// key a server-wide setting, all clients share the quota.
+//
+// The counters live in memory and the configured file is only read at startup.
+// Calls are written to it a while after they were counted, or by Save. Keys are
+// stored as hashes only, so the file doesn't reveal them.
+type Quota struct {
+	mu      sync.Mutex
+	cfg     QuotaConfig
+	key     string
+	clock   func() time.Time
+	usage   usage
+	others  map[string]usage // counters of other keys, kept in the file
+	pending bool             // a save is scheduled
+
+	saveMu sync.Mutex // serializes writing the file
+}
+
+// NewQuota tracks the calls of the API key apikey, starting with the counter
+// persisted in the configured file.
+func NewQuota(cfg QuotaConfig, apikey string, clock func() time.Time) (*Quota, error) {
+	if cfg.Period != PeriodDay && cfg.Period != PeriodMonth {
+		return nil, fmt.Errorf("unknown quota period %#v", cfg.Period)
+	}
+
+	sum := sha256.Sum256([]byte(apikey))
+	q := &Quota{
+		cfg:   cfg,
+		key:   hex.EncodeToString(sum[:]),
+		clock: clock,
+	}
+
+	all, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	q.usage = all[q.key]
+	delete(all, q.key)
+	q.others = all
+
+	quotaRemaining.Set(ProviderName, expvar.Func(func() any {
+		return q.Remaining()
+	}))
+	return q, nil
+}
+
+// Remaining returns the calls left in the current period.
+func (q *Quota) Remaining() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover()
+	return max(q.cfg.Budget-q.usage.Calls, 0)
+}
+
+// Transport wraps the transport next, which defaults to http.DefaultTransport
+// if nil. It counts every call and refuses calls once the budget runs low with
+// a *aggregator.ProviderError wrapping aggregator.ErrQuotaExhausted.
+func (q *Quota) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return quotaTransport{quota: q, next: next}
+}
+
+// take counts a call, unless the budget is down to the reserve.
+func (q *Quota) take() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover()
+	if q.cfg.Budget-q.usage.Calls <= q.cfg.Reserve {
+		return &aggregator.ProviderError{
+			Provider:   ProviderName,
+			Kind:       aggregator.KindRateLimited,
+			RetryAfter: q.nextPeriod().Sub(q.clock()),
+			Err: fmt.Errorf(
+				"%w: %d of %d calls this %s used",
+				aggregator.ErrQuotaExhausted, q.usage.Calls, q.cfg.Budget, q.cfg.Period,
+			),
+		}
+	}
+
+	q.usage.Calls++
+	if q.cfg.File != "" && !q.pending {
+		q.pending = true
+		time.AfterFunc(q.cfg.Flush, q.flush)
+	}
+	return nil
+}
+
+// flush saves the counters scheduled by take.
+func (q *Quota) flush() {
+	if err := q.Save(); err != nil {
+		// Losing count is better than losing the forecast.
+		slog.Default().Warn("Persisting WeatherAPI quota failed.", slog.Any("err", err))
+	}
+}
+
+// rollover starts counting anew once the period is over.
+func (q *Quota) rollover() {
+	if p := q.period(q.clock()); p != q.usage.Period {
+		q.usage = usage{Period: p}
+	}
+}
+
+// period names the period the time t is in.
+func (q *Quota) period(t time.Time) string {
+	if q.cfg.Period == PeriodDay {
+		return t.UTC().Format(time.DateOnly)
+	}
+	return t.UTC().Format("2006-01")
+}
+
+// nextPeriod returns the start of the following period.
+func (q *Quota) nextPeriod() time.Time {
+	t := q.clock().UTC()
+	if q.cfg.Period == PeriodDay {
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// load reads the counters of all keys from the file.
+func (q *Quota) load() (map[string]usage, error) {
+	res := make(map[string]usage)
+	if q.cfg.File == "" {
+		return res, nil
+	}
+
+	bb, err := os.ReadFile(q.cfg.File)
+	if errors.Is(err, fs.ErrNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read quota file: %w", err)
+	}
+
+	if err := json.Unmarshal(bb, &res); err != nil {
+		return nil, fmt.Errorf("unmarshal quota file %s: %w", q.cfg.File, err)
+	}
+	return res, nil
+}
+
+// Save writes the counters into the file right away, i.e. on shutdown. Only a
+// snapshot is taken under the lock, so calls aren't held up by the disk.
+// The file is replaced at once, so a crash doesn't leave half of it behind.
+func (q *Quota) Save() error {
+	if q.cfg.File == "" {
+		return nil
+	}
+
+	q.saveMu.Lock()
+	defer q.saveMu.Unlock()
+
+	q.mu.Lock()
+	q.pending = false
+	all := maps.Clone(q.others)
+	all[q.key] = q.usage
+	q.mu.Unlock()
+
+	bb, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal quota: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(q.cfg.File), ".quota-*")
+	if err != nil {
+		return fmt.Errorf("create quota file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bb); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write quota file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write quota file: %w", err)
+	}
+	return os.Rename(tmp.Name(), q.cfg.File)
+}
+
+// quotaTransport counts the calls going through it against the quota.
+type quotaTransport struct {
+	quota *Quota
+	next  http.RoundTripper
+}
+
+func (t quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.quota.take(); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,145 @@
+package weatherapi_test
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/weatherapi"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+const quotaBody = `{"forecast":{"forecastday":[{"date":"2024-11-05","day":{"maxtemp_c":19.8}}]}}`
+
+// quotaCaller returns a caller whose calls are counted against the quota q.
+func quotaCaller(t *testing.T, q *weatherapi.Quota, requests *[]*http.Request) *weatherapi.Caller {
+	t.Helper()
+
+	c := cannedClient(quotaBody, requests)
+	c.Transport = q.Transport(c.Transport)
+
+	sut, err := weatherapi.DebuggingCaller("secret", nil, c, time.Now)
+	if err != nil {
+		t.Errorf("creating DebuggingCaller: %+v", err)
+		t.Fatal("Aborting")
+	}
+	return sut
+}
+
+func TestQuota_SkipsWeatherAPIWhenBudgetRunsLow(t *testing.T) {
+	now := time.Date(2024, 11, 5, 12, 0, 0, 0, time.UTC)
+	q, err := weatherapi.NewQuota(weatherapi.QuotaConfig{
+		Budget:  3,
+		Period:  weatherapi.PeriodMonth,
+		Reserve: 1,
+	}, "secret", func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("create quota: %+v", err)
+	}
+
+	var requests []*http.Request
+	sut := quotaCaller(t, q, &requests)
+	query := types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 1}
+
+	for i := range 2 {
+		if _, err := sut.AggregateWeather(context.Background(), query); err != nil {
+			t.Fatalf("Call %d within budget must succeed, got %+v", i, err)
+		}
+	}
+	if got := q.Remaining(); got != 1 {
+		t.Errorf("Two of three calls must leave one, got %d", got)
+	}
+	if got := expvar.Get("quota_remaining").String(); !strings.Contains(got, `"weatherapi": 1`) {
+		t.Errorf("Remaining budget must show up in the expvars, got %s", got)
+	}
+
+	_, err = sut.AggregateWeather(context.Background(), query)
+	if !errors.Is(err, aggregator.ErrQuotaExhausted) {
+		t.Fatalf("Call into the reserve must be refused with aggregator.ErrQuotaExhausted, got %+v", err)
+	}
+	var pErr *aggregator.ProviderError
+	if !errors.As(err, &pErr) || pErr.Kind != aggregator.KindRateLimited {
+		t.Errorf("Refused call must be rate limited, got %+v", err)
+	}
+	if want := 26*24*time.Hour - 12*time.Hour; pErr != nil && pErr.RetryAfter != want {
+		t.Errorf("Refused call must retry next month, want %s, got %s", want, pErr.RetryAfter)
+	}
+	if len(requests) != 2 {
+		t.Errorf("Refused call must not reach WeatherAPI, got %d requests", len(requests))
+	}
+}
+
+func TestQuota_PersistsAcrossRestarts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "quota.json")
+	now := time.Date(2024, 11, 5, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	cfg := weatherapi.QuotaConfig{
+		Budget: 10,
+		Period: weatherapi.PeriodDay,
+		File:   file,
+		Flush:  time.Hour,
+	}
+
+	q, err := weatherapi.NewQuota(cfg, "secret", clock)
+	if err != nil {
+		t.Fatalf("create quota: %+v", err)
+	}
+	var requests []*http.Request
+	sut := quotaCaller(t, q, &requests)
+	query := types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 1}
+	for range 2 {
+		if _, err := sut.AggregateWeather(context.Background(), query); err != nil {
+			t.Fatalf("Call within budget must succeed, got %+v", err)
+		}
+	}
+
+	if _, err := os.Stat(file); err == nil {
+		t.Error("Counted calls must not be written before the flush")
+	}
+	if err := q.Save(); err != nil {
+		t.Fatalf("save quota: %+v", err)
+	}
+
+	restarted, err := weatherapi.NewQuota(cfg, "secret", clock)
+	if err != nil {
+		t.Fatalf("create quota from file: %+v", err)
+	}
+	if got := restarted.Remaining(); got != 8 {
+		t.Errorf("Restarted quota must remember the calls, want 8 remaining, got %d", got)
+	}
+
+	other, err := weatherapi.NewQuota(cfg, "another-key", clock)
+	if err != nil {
+		t.Fatalf("create quota of another key: %+v", err)
+	}
+	if got := other.Remaining(); got != 10 {
+		t.Errorf("Quota must be tracked per key, want 10 remaining, got %d", got)
+	}
+
+	now = now.AddDate(0, 0, 1)
+	if got := restarted.Remaining(); got != 10 {
+		t.Errorf("Quota must start anew the next day, want 10 remaining, got %d", got)
+	}
+
+	bb, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read quota file: %+v", err)
+	}
+	if strings.Contains(string(bb), "secret") {
+		t.Errorf("Quota file must not reveal the API key, got %s", bb)
+	}
+}
+
+func TestQuota_UnknownPeriod(t *testing.T) {
+	_, err := weatherapi.NewQuota(weatherapi.QuotaConfig{Budget: 1, Period: "week"}, "secret", time.Now)
+	if err == nil {
+		t.Error("Unknown period must be rejected")
+	}
+}
@@ -1,48 +1,74 @@
 package weatherapi
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"log/slog"
 	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
-	"golang.org/x/sync/errgroup"
 )
 
-var ErrNoApiKeyProvided = errors.New("API key missing")
-
 // Caller shall implement the api.Aggregator interface to make WeatherAPI calls.
 type Caller struct {
 	client *http.Client
 	apikey string
 	clock  func() time.Time
+	base   url.URL
 }
 
-// NewCaller creates a pre-configured caller that uses the provided API key.
-func NewCaller(apikey string) (*Caller, error) {
-	return DebuggingCaller(apikey, &http.Client{}, time.Now)
+// DefaultBaseURL is where the WeatherAPI lives.
+const DefaultBaseURL = "https://api.weatherapi.com"
+
+// NewCaller creates a pre-configured caller that uses the provided API key and
+// retries failed calls according to the policy retry. Every call including the
+// retries is counted against the quota, unless it's nil.
+// A nil base calls the DefaultBaseURL.
+func NewCaller(apikey string, base *url.URL, retry aggregator.RetryPolicy, quota *Quota) (*Caller, error) {
+	var next http.RoundTripper
+	if quota != nil {
+		next = quota.Transport(nil)
+	}
+	client := &http.Client{Transport: aggregator.NewRetryTransport(next, retry)}
+
+	return DebuggingCaller(apikey, base, client, time.Now)
 }
 
 // DebuggingCaller lets inject non-default implementation for testing and
-// debugging sessions.
-func DebuggingCaller(key string, c *http.Client, cf func() time.Time) (*Caller, error) {
+// debugging sessions, i.e. the base URL of a httptest.Server.
+// A nil base calls the DefaultBaseURL.
+func DebuggingCaller(key string, base *url.URL, c *http.Client, cf func() time.Time) (*Caller, error) {
 	var empty string
 	if empty == key {
-		return nil, ErrNoApiKeyProvided
+		return nil, aggregator.ErrNoApiKeyProvided
+	}
+	if base == nil {
+		base, _ = url.Parse(DefaultBaseURL)
 	}
 	return &Caller{
 		apikey: key,
 		client: c,
 		clock:  cf,
+		base:   *base,
 	}, nil
 }
 
-const daysToFetch = 5
+// maxForecastDays is what WeatherAPI serves on its paid plans.
+const maxForecastDays = 14
+
+// ProviderName identifies this provider in errors and in the provider registry.
+const ProviderName = "weatherapi"
+
+// DisplayName, Attribution and AttributionURL credit WeatherAPI next to its
+// forecasts, as its terms ask for a link back.
+const (
+	DisplayName    = "WeatherAPI.com"
+	Attribution    = "Powered by WeatherAPI.com"
+	AttributionURL = "https://www.weatherapi.com/"
+)
 
 // wrapper is the upper data structure of WeatherAPI result.
 // The whole structure is here to unmarshal the received JSON into.
@@ -57,113 +83,228 @@ type collection struct {
 
 // forecast contains the date and the grouped forecasts of WeatherAPI result.
 type forecast struct {
-	Date string `json:"date"`
-	Day  day    `json:"day"`
+	Date  string `json:"date"`
+	Day   day    `json:"day"`
+	Astro astro  `json:"astro"`
+	Hour  []hour `json:"hour"`
 }
 
 // day finally contains all the forecast information for the given day.
 type day struct {
-	MaxTemp float32 `json:"maxtemp_c"`
+	MaxTemp      float32   `json:"maxtemp_c"`
+	MinTemp      float32   `json:"mintemp_c"`
+	TotalPrecip  float32   `json:"totalprecip_mm"`
+	ChanceOfRain float32   `json:"daily_chance_of_rain"`
+	MaxWind      float32   `json:"maxwind_kph"`
+	AvgHumidity  float32   `json:"avghumidity"`
+	UV           float32   `json:"uv"`
+	Condition    condition `json:"condition"`
+}
+
+// condition is the weather condition of a day or hour in WeatherAPI codes.
+type condition struct {
+	Code int `json:"code"`
+}
+
+// astro holds sunrise and sunset as local wall clock like "07:45 AM".
+type astro struct {
+	Sunrise string `json:"sunrise"`
+	Sunset  string `json:"sunset"`
+}
+
+// hour holds the hourly values. The daily summary uses them for the values
+// WeatherAPI lacks on the day level.
+type hour struct {
+	TimeEpoch    int64     `json:"time_epoch"`
+	Time         string    `json:"time"`
+	TempC        float32   `json:"temp_c"`
+	PrecipMm     float32   `json:"precip_mm"`
+	ChanceOfRain float32   `json:"chance_of_rain"`
+	WindDegree   float32   `json:"wind_degree"`
+	WindKph      float32   `json:"wind_kph"`
+	GustKph      float32   `json:"gust_kph"`
+	Cloud        float32   `json:"cloud"`
+	Condition    condition `json:"condition"`
+}
+
+// toForecast converts the WeatherAPI day into the exchange format, only
+// filling the values the query asked for.
+func (f forecast) toForecast(q types.Query) types.Forecast {
+	res := types.Forecast{Date: f.Date}
+	if q.Wants(types.VarMaxTemp) {
+		res.MaxTemp = f.Day.MaxTemp
+	}
+	if q.Wants(types.VarMinTemp) {
+		res.MinTemp = f.Day.MinTemp
+	}
+	if q.Wants(types.VarPrecipitationSum) {
+		res.PrecipitationSum = f.Day.TotalPrecip
+	}
+	if q.Wants(types.VarPrecipitationProbability) {
+		res.PrecipitationProbability = f.Day.ChanceOfRain
+	}
+	if q.Wants(types.VarMaxWindSpeed) {
+		res.MaxWindSpeed = f.Day.MaxWind
+	}
+	if q.Wants(types.VarMaxWindGust) {
+		res.MaxWindGust = maxGust(f.Hour)
+	}
+	if q.Wants(types.VarWindDirection) {
+		res.WindDirection = dominantDirection(f.Hour)
+	}
+	if q.Wants(types.VarRelativeHumidity) {
+		res.RelativeHumidity = f.Day.AvgHumidity
+	}
+	if q.Wants(types.VarUVIndex) {
+		res.UVIndex = f.Day.UV
+	}
+	if q.Wants(types.VarSunrise) {
+		res.Sunrise = localTime(f.Date, f.Astro.Sunrise)
+	}
+	if q.Wants(types.VarSunset) {
+		res.Sunset = localTime(f.Date, f.Astro.Sunset)
+	}
+	if q.Wants(types.VarCondition) {
+		res.Condition = conditionOf(f.Day.Condition)
+	}
+	return res
+}
+
+// maxGust finds the strongest gust of the day in the hourly values.
+func maxGust(hh []hour) float32 {
+	var res float32
+	for _, h := range hh {
+		res = max(res, h.GustKph)
+	}
+	return res
+}
+
+// dominantDirection sums up the hourly winds into the dominant direction.
+func dominantDirection(hh []hour) float32 {
+	ww := make([]aggregator.Wind, 0, len(hh))
+	for _, h := range hh {
+		ww = append(ww, aggregator.Wind{Speed: h.WindKph, Direction: h.WindDegree})
+	}
+	return aggregator.DominantDirection(ww)
+}
+
+// localTime turns the wall clock of WeatherAPI into an ISO 8601 local time on
+// the given date, like OpenMeteo does. Polar days and nights come without a
+// valid time, so they end up empty.
+func localTime(date, clock string) string {
+	t, err := time.Parse("2006-01-02 03:04 PM", date+" "+clock)
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04")
 }
 
 // AggregateWeather implements the api.Aggregator interface on Caller
-func (c *Caller) AggregateWeather(lat, lon float64) (types.FiveDayForecast, error) {
-	results := make(chan types.Forecast)
-
-	g := new(errgroup.Group)
-	requestUrls := c.urlsToFetchIncluding(c.clock(), daysToFetch, lat, lon)
-
-	// First error-prone go routine:
-	// Request one URL after the other and put the result into the results channel
-	g.Go(func() error {
-		defer close(results)
-		for _, u := range requestUrls {
-			resp, err := c.client.Get(u.String())
-			if err != nil {
-				return fmt.Errorf("Get %s failed: %w", u.String(), err)
-			}
-
-			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("GET %s unexpected status, want %d, got %d", u.String(), http.StatusOK, resp.StatusCode)
-			}
-
-			bb, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return fmt.Errorf("Reads response data from %s failed: %w", u.String(), err)
-			}
-
-			var tmp wrapper
-			if err = json.Unmarshal(bb, &tmp); err != nil {
-				return fmt.Errorf("Unmarshal response data from %s failed: %w", u.String(), err)
-			}
-
-			d := tmp.Forecast.ForecastDay[0].Date
-			t := tmp.Forecast.ForecastDay[0].Day.MaxTemp
-			res := types.Forecast{Date: d, MaxTemp: t}
-
-			results <- res
-		}
-		return nil
-	})
-
-	// error groups work like wait groups: They wait until the provided function
-	// returns. In addition they keep track of all errors that occured.
-	go func() {
-		if err := g.Wait(); err != nil {
-			slog.Default().Info("Downloading data failed.", slog.Any("err", err))
+// All days are fetched with a single request, as every request counts against
+// the quota of the API key.
+func (c *Caller) AggregateWeather(ctx context.Context, q types.Query) (types.DailyForecast, error) {
+	if q.Days > maxForecastDays {
+		return nil, &aggregator.HorizonError{
+			Provider:  ProviderName,
+			Max:       maxForecastDays,
+			Requested: q.Days,
+			Unit:      "days",
 		}
-	}()
+	}
 
-	var res types.FiveDayForecast
-	// Second Go Routine converting the downloaded results into the exchange format
-	// with 5 forecasts in one struct.
-	g.Go(func() error {
-		rr := make([]types.Forecast, 0, 5)
+	u := c.forecastURL(q.Days, q.Lat, q.Lon)
 
-		for r := range results {
-			rr = append(rr, r)
+	var tmp wrapper
+	if err := c.fetch(ctx, u, &tmp); err != nil {
+		return nil, aggregator.Failed(ctx, ProviderName, err)
+	}
+
+	dd := tmp.Forecast.ForecastDay
+	if err := contiguous(dd, q.Days); err != nil {
+		return nil, &aggregator.ProviderError{
+			Provider: ProviderName,
+			Kind:     aggregator.KindDecode,
+			Err:      fmt.Errorf("Invalid response data from %s: %w", aggregator.Redacted(u, "key"), err),
 		}
+	}
 
-		res.Day1 = types.Forecast{Date: rr[0].Date, MaxTemp: rr[0].MaxTemp}
-		res.Day2 = types.Forecast{Date: rr[1].Date, MaxTemp: rr[1].MaxTemp}
-		res.Day3 = types.Forecast{Date: rr[2].Date, MaxTemp: rr[2].MaxTemp}
-		res.Day4 = types.Forecast{Date: rr[3].Date, MaxTemp: rr[3].MaxTemp}
-		res.Day5 = types.Forecast{Date: rr[4].Date, MaxTemp: rr[4].MaxTemp}
+	res := make(types.DailyForecast, 0, len(dd))
+	for _, d := range dd {
+		res = append(res, d.toForecast(q))
+	}
+	return res, nil
+}
 
-		return nil
-	})
+// contiguous checks the response holds `days` days, each one following the
+// day before, so no day is missing or mixed up.
+func contiguous(dd []forecast, days int) error {
+	if len(dd) != days {
+		return fmt.Errorf("received %d of %d forecasts", len(dd), days)
+	}
 
-	// Synchronously wait for all downloaded data to be converted.
-	if err := g.Wait(); err != nil {
-		slog.Default().Error("Converting failed.", slog.Any("err", err))
+	var prev time.Time
+	for i, d := range dd {
+		date, err := time.Parse(time.DateOnly, d.Date)
+		if err != nil {
+			return fmt.Errorf("parse date of day %d: %w", i, err)
+		}
+		if i > 0 && !date.Equal(prev.AddDate(0, 0, 1)) {
+			return fmt.Errorf("day %d is %s, want the day after %s", i, d.Date, prev.Format(time.DateOnly))
+		}
+		prev = date
 	}
+	return nil
+}
 
-	return res, nil
+// MaxForecastDays implements the api.Aggregator interface and reports how many
+// days ahead the API is able to forecast.
+func (c *Caller) MaxForecastDays() int {
+	return maxForecastDays
 }
 
-// urlsToFetchIncluding helps to generate the requested amount of API endpoint
-// URLs with the provided start date `d`, counting one day up `amount` times.
-func (c *Caller) urlsToFetchIncluding(d time.Time, amount int, lat, lon float64) []url.URL {
-	res := make([]url.URL, 0, amount)
+// forecastURL generates the API endpoint URL for `days` days of forecasts,
+// starting with today in the timezone of the location.
+func (c *Caller) forecastURL(days int, lat, lon float64) url.URL {
+	res := c.base.JoinPath("v1", "forecast.json")
+	res.RawQuery = fmt.Sprintf(
+		"key=%s&q=%f,%f&days=%d",
+		c.apikey, lat, lon, days,
+	)
+	return *res
+}
 
-	latest := d
+// apiError is the body WeatherAPI answers failed requests with.
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
 
-	for i := 0; i < amount; i++ {
-		date := latest.Format(time.DateOnly)
+// errorKinds classifies the error codes of WeatherAPI.
+// See https://www.weatherapi.com/docs/#intro-error-codes
+var errorKinds = map[int]aggregator.Kind{
+	1002: aggregator.KindAuth,
+	1006: aggregator.KindInvalidLocation,
+	2006: aggregator.KindAuth,
+	2007: aggregator.KindRateLimited,
+	2008: aggregator.KindAuth,
+	2009: aggregator.KindAuth,
+}
 
-		u := url.URL{
-			Scheme: "https",
-			Host:   "api.weatherapi.com",
-			Path:   "/v1/forecast.json",
-			RawQuery: fmt.Sprintf(
-				"key=%s&q=%f,%f&date=%s&day=maxtemp_c",
-				c.apikey, lat, lon, date,
-			),
-		}
-		res = append(res, u)
+// classify explains failed responses by the error code in their body, as
+// WeatherAPI's HTTP status codes mix up exceeded quotas with invalid keys.
+func classify(_ int, body []byte) (aggregator.Kind, string) {
+	var res apiError
+	// The error code only adds details, so a body that doesn't fit is fine.
+	_ = json.Unmarshal(body, &res)
 
-		latest = latest.AddDate(0, 0, 1)
-	}
+	details := fmt.Sprintf("%d %s", res.Error.Code, res.Error.Message)
+	return errorKinds[res.Error.Code], details
+}
 
-	return res
+// fetch unmarshals the JSON response of the URL u into v. WeatherAPI explains
+// its failures with error codes, see classify.
+func (c *Caller) fetch(ctx context.Context, u url.URL, v any) error {
+	return aggregator.FetchJSON(ctx, c.client, ProviderName, u, "key", classify, v)
 }
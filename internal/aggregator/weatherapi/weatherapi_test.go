@@ -1,105 +1,424 @@
 package weatherapi_test
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
-	openweathermap "github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/weatherapi"
+	"github.com/marcofeltmann/weather-forecast-aggregator/aggregatortest"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/fake"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/replay"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/weatherapi"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
 )
 
-// TestHappyPath should test the happy path. Turned out that didn't work as we
-// cannot have historical data from the forecast endpoint.
-// As I'm unsure if I should test against another endpoint or try to mock the
-// output data I didn't invest more time here. It's good enough for a human to
-// verify if the data is there.
+// TestHappyPath runs against the fake WeatherAPI server, which serves the
+// forecast from the day of its clock on.
 func TestHappyPath(t *testing.T) {
 	lat, lon := 42.6493934, -8.8201753
 
-	key, err := apiKey()
-	if err != nil {
-		t.Fatalf("OpenWeatherMap API Key retrieval: %+v", err)
+	today := func() time.Time {
+		return time.Date(2024, 11, 5, 10, 0, 0, 0, time.UTC)
 	}
 
-	t.Log("This test runs against the real forecast endpoint, as the historical API differs.")
-	t.Log("So it might break every single day.")
+	srv := fake.NewWeatherAPI(t, "secret")
+	srv.SetClock(today)
+	srv.SetDays(
+		fake.Day{MaxTemp: 19.8},
+		fake.Day{MaxTemp: 22.1},
+		fake.Day{MaxTemp: 21},
+		fake.Day{MaxTemp: 19},
+		fake.Day{MaxTemp: 19},
+	)
 
-	// Technical debt: This uses the default http.Client and calls the API endpoint.
-	// As nobody knows how long the historical data is stored there might be false
-	// negatives in the future.
-	sut, err := openweathermap.DebuggingCaller(key, &http.Client{}, time.Now)
+	sut, err := weatherapi.DebuggingCaller("secret", srv.BaseURL(), srv.Client(), today)
 	if err != nil {
 		t.Errorf("creating DebuggingCaller: %+v", err)
 		t.Fatal("Aborting")
 	}
 
-	got, err := sut.AggregateWeather(lat, lon)
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:       lat,
+		Lon:       lon,
+		Days:      5,
+		Variables: []types.Variable{types.VarMaxTemp},
+	})
 	if err != nil {
 		t.Errorf("aggregate: %+v", err)
 		t.Fatal("Cannot verify result, aborting.")
 	}
 
-	/*
-			  types.FiveDayForecast{
-		  	Day1: types.Forecast{
-		- 		Date:    "2024-10-25",
-		+ 		Date:    "2024-11-05",
-		- 		MaxTemp: 14.600000381469727,
-		+ 		MaxTemp: 19.799999237060547,
-		  	},
-		  	Day2: types.Forecast{
-		- 		Date:    "2024-10-26",
-		+ 		Date:    "2024-11-06",
-		- 		MaxTemp: 14.899999618530273,
-		+ 		MaxTemp: 22.100000381469727,
-		  	},
-		  	Day3: types.Forecast{
-		- 		Date:    "2024-10-27",
-		+ 		Date:    "2024-11-07",
-		- 		MaxTemp: 18.200000762939453,
-		+ 		MaxTemp: 21,
-		  	},
-		  	Day4: types.Forecast{
-		- 		Date:    "2024-10-28",
-		+ 		Date:    "2024-11-08",
-		- 		MaxTemp: 21.200000762939453,
-		+ 		MaxTemp: 19,
-		  	},
-		  	Day5: types.Forecast{
-		- 		Date:    "2024-10-29",
-		+ 		Date:    "2024-11-09",
-		- 		MaxTemp: 22.299999237060547,
-		+ 		MaxTemp: 19,
-		  	},
-	*/
-	want := types.FiveDayForecast{
-		Day1: types.Forecast{Date: "2024-11-05", MaxTemp: 19.8},
-		Day2: types.Forecast{Date: "2024-11-06", MaxTemp: 22.1},
-		Day3: types.Forecast{Date: "2024-11-07", MaxTemp: 21},
-		Day4: types.Forecast{Date: "2024-11-08", MaxTemp: 19},
-		Day5: types.Forecast{Date: "2024-11-09", MaxTemp: 19},
+	want := types.DailyForecast{
+		{Date: "2024-11-05", MaxTemp: 19.8},
+		{Date: "2024-11-06", MaxTemp: 22.1},
+		{Date: "2024-11-07", MaxTemp: 21},
+		{Date: "2024-11-08", MaxTemp: 19},
+		{Date: "2024-11-09", MaxTemp: 19},
+	}
+
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+// record refreshes the fixtures in testdata from the real API with the key in
+// WEATHER_API_KEY, i.e.
+// WEATHER_API_KEY=… go test ./internal/aggregator/weatherapi -record
+var record = flag.Bool("record", false, "record the fixtures from the upstream API")
+
+// TestFixture replays a real response from testdata. The key is redacted in the
+// fixture, so any key replays it. The current weather changes with every call
+// and isn't used, so it's scrubbed.
+//
+// A fresh recording covers other dates, so record mode only checks that the
+// forecast makes sense.
+func TestFixture(t *testing.T) {
+	key, mode := "any", replay.ModeReplay
+	if *record {
+		key, mode = os.Getenv("WEATHER_API_KEY"), replay.ModeRecord
+		if key == "" {
+			t.Skip("Recording needs the API key in WEATHER_API_KEY")
+		}
+	}
+	client := &http.Client{Transport: replay.NewTransport(nil, replay.Config{
+		Dir:    "testdata",
+		Mode:   mode,
+		Redact: []string{"key"},
+		Scrub:  replay.DropFields("current"),
+	})}
+
+	sut, err := weatherapi.DebuggingCaller(key, nil, client, time.Now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:       42.6493934,
+		Lon:       -8.8201753,
+		Days:      5,
+		Variables: []types.Variable{types.VarMaxTemp, types.VarMinTemp, types.VarSunrise},
+	})
+	if err != nil {
+		t.Fatalf("aggregate: %+v", err)
+	}
+
+	if *record {
+		checkRecorded(t, got, 5)
+		return
+	}
+
+	want := types.DailyForecast{
+		{Date: "2024-11-05", MaxTemp: 19.8, MinTemp: 12.1, Sunrise: "2024-11-05T08:16"},
+		{Date: "2024-11-06", MaxTemp: 22.1, MinTemp: 13.4, Sunrise: "2024-11-06T08:17"},
+		{Date: "2024-11-07", MaxTemp: 21, MinTemp: 14, Sunrise: "2024-11-07T08:18"},
+		{Date: "2024-11-08", MaxTemp: 19, MinTemp: 13.2, Sunrise: "2024-11-08T08:20"},
+		{Date: "2024-11-09", MaxTemp: 19, MinTemp: 12.6, Sunrise: "2024-11-09T08:21"},
+	}
+
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
+}
+
+// checkRecorded verifies the invariants of a freshly recorded forecast ff of n
+// days: contiguous dates, each with its sunrise and no minimum above the maximum.
+func checkRecorded(t *testing.T, ff types.DailyForecast, n int) {
+	t.Helper()
+
+	if len(ff) != n {
+		t.Fatalf("Recorded forecast must have %d days, got %d", n, len(ff))
+	}
+	start, err := time.Parse(time.DateOnly, ff[0].Date)
+	if err != nil {
+		t.Fatalf("Recorded forecast must start with a date, got %q", ff[0].Date)
+	}
+	for i, f := range ff {
+		if want := start.AddDate(0, 0, i).Format(time.DateOnly); f.Date != want {
+			t.Errorf("Day %d must be %s, got %s", i, want, f.Date)
+		}
+		if !strings.HasPrefix(f.Sunrise, f.Date) {
+			t.Errorf("Sunrise of %s must be on that day, got %q", f.Date, f.Sunrise)
+		}
+		if f.MinTemp > f.MaxTemp {
+			t.Errorf("Minimum of %s must not exceed the maximum, got %v > %v", f.Date, f.MinTemp, f.MaxTemp)
+		}
+	}
+}
+
+// TestConformance runs the conformance suite against the fake WeatherAPI
+// server.
+func TestConformance(t *testing.T) {
+	srv := fake.NewWeatherAPI(t, "secret")
+	aggregatortest.Run(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			sut, err := weatherapi.DebuggingCaller("secret", srv.BaseURL(), client, time.Now)
+			if err != nil {
+				t.Fatalf("creating DebuggingCaller: %+v", err)
+			}
+			return sut
+		},
+		Upstream: srv.Client().Transport,
+		Secret:   "secret",
+	})
+}
+
+// TestMalformedResponse verifies a broken body is reported as decode failure
+// and that a wrong key is refused as such.
+func TestMalformedResponse(t *testing.T) {
+	srv := fake.NewWeatherAPI(t, "secret")
+	srv.Enqueue(fake.Response{Body: `{"forecast":{"forecastday":[`})
+
+	q := types.Query{Lat: 42.6493934, Lon: -8.8201753, Days: 3}
+
+	sut, err := weatherapi.DebuggingCaller("secret", srv.BaseURL(), srv.Client(), time.Now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+	_, err = sut.AggregateWeather(context.Background(), q)
+
+	var pErr *aggregator.ProviderError
+	if !errors.As(err, &pErr) || pErr.Kind != aggregator.KindDecode {
+		t.Errorf("Malformed JSON must be a decode failure, got %+v", err)
+	}
+
+	sut, err = weatherapi.DebuggingCaller("wrong", srv.BaseURL(), srv.Client(), time.Now)
+	if err != nil {
+		t.Fatalf("creating DebuggingCaller: %+v", err)
+	}
+	_, err = sut.AggregateWeather(context.Background(), q)
+
+	if !errors.As(err, &pErr) || pErr.Kind != aggregator.KindAuth {
+		t.Errorf("Wrong API key must be an auth failure, got %+v", err)
+	}
+}
+
+// TestCanceledContext verifies a cancelled request does not reach out to the
+// API and reports the typed cancellation error. It doesn't need a real key.
+func TestCanceledContext(t *testing.T) {
+	lat, lon := 42.6493934, -8.8201753
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sut, err := weatherapi.DebuggingCaller("no-key", nil, &http.Client{}, time.Now)
+	if err != nil {
+		t.Errorf("creating DebuggingCaller: %+v", err)
+		t.Fatal("Aborting")
 	}
 
+	_, err = sut.AggregateWeather(ctx, types.Query{
+		Lat:       lat,
+		Lon:       lon,
+		Days:      5,
+		Variables: []types.Variable{types.VarMaxTemp},
+	})
+
+	var cErr *aggregator.CanceledError
+	if !errors.As(err, &cErr) {
+		t.Fatalf("Cancelled context must return *aggregator.CanceledError, got %+v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancellation error must unwrap to context.Canceled, got %+v", err)
+	}
+}
+
+// cannedClient answers every request with the JSON body and counts the
+// requests it received.
+func cannedClient(body string, requests *[]*http.Request) *http.Client {
+	return &http.Client{Transport: aggregatortest.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		*requests = append(*requests, r)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+}
+
+// TestSingleMultiDayRequest verifies all days are fetched with one request and
+// every forecastday entry is decoded.
+func TestSingleMultiDayRequest(t *testing.T) {
+	body := `{"forecast":{"forecastday":[
+		{"date":"2024-11-05","day":{"maxtemp_c":19.8,"mintemp_c":12.1}},
+		{"date":"2024-11-06","day":{"maxtemp_c":22.1,"mintemp_c":13.4}},
+		{"date":"2024-11-07","day":{"maxtemp_c":21,"mintemp_c":14}}
+	]}}`
+
+	var requests []*http.Request
+	sut, err := weatherapi.DebuggingCaller("secret", nil, cannedClient(body, &requests), time.Now)
+	if err != nil {
+		t.Errorf("creating DebuggingCaller: %+v", err)
+		t.Fatal("Aborting")
+	}
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:       42.6493934,
+		Lon:       -8.8201753,
+		Days:      3,
+		Variables: []types.Variable{types.VarMaxTemp, types.VarMinTemp},
+	})
+	if err != nil {
+		t.Fatalf("aggregate canned response: %+v", err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("All days must be fetched with a single request, got %d", len(requests))
+	}
+	if days := requests[0].URL.Query().Get("days"); days != "3" {
+		t.Errorf("Request must ask for 3 days, got %#v", days)
+	}
+
+	want := types.DailyForecast{
+		{Date: "2024-11-05", MaxTemp: 19.8, MinTemp: 12.1},
+		{Date: "2024-11-06", MaxTemp: 22.1, MinTemp: 13.4},
+		{Date: "2024-11-07", MaxTemp: 21, MinTemp: 14},
+	}
 	if !cmp.Equal(want, got) {
 		fmt.Println(cmp.Diff(want, got))
 		t.Error("output mismatch, see diff")
 	}
 }
 
-// apiKey is a helper function to get the API key from an envvar.
-// The github.com/ardanlabs/conf/v3 package doesn't help here.
-func apiKey() (string, error) {
-	res := os.Getenv("WEATHER_API_KEY")
-	var empty string
+type gapTestValues struct {
+	name string
+	body string
+}
+
+// TestNonContiguousDays verifies responses with missing, repeated or unordered
+// days are rejected, and that the error doesn't reveal the API key.
+func TestNonContiguousDays(t *testing.T) {
+	rr := []gapTestValues{
+		{
+			name: "gap",
+			body: `{"forecast":{"forecastday":[{"date":"2024-11-05"},{"date":"2024-11-07"}]}}`,
+		},
+		{
+			name: "repeated",
+			body: `{"forecast":{"forecastday":[{"date":"2024-11-05"},{"date":"2024-11-05"}]}}`,
+		},
+		{
+			name: "unordered",
+			body: `{"forecast":{"forecastday":[{"date":"2024-11-06"},{"date":"2024-11-05"}]}}`,
+		},
+		{
+			name: "short",
+			body: `{"forecast":{"forecastday":[{"date":"2024-11-05"}]}}`,
+		},
+		{
+			name: "empty",
+			body: `{}`,
+		},
+	}
+
+	for _, r := range rr {
+		t.Run(r.name, func(t *testing.T) {
+			var requests []*http.Request
+			sut, err := weatherapi.DebuggingCaller("secret", nil, cannedClient(r.body, &requests), time.Now)
+			if err != nil {
+				t.Errorf("creating DebuggingCaller: %+v", err)
+				t.Fatal("Aborting")
+			}
+
+			got, err := sut.AggregateWeather(context.Background(), types.Query{
+				Lat:  42.6493934,
+				Lon:  -8.8201753,
+				Days: 2,
+			})
+			var pErr *aggregator.ProviderError
+			if !errors.As(err, &pErr) {
+				t.Fatalf("Non-contiguous days must return *aggregator.ProviderError, got %+v and %+v", got, err)
+			}
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("Error must not reveal the API key, got %q", err.Error())
+			}
+		})
+	}
+}
+
+// TestErrorKinds verifies the WeatherAPI error codes are classified, so a bad
+// key can be told apart from an exceeded quota or an outage.
+func TestErrorKinds(t *testing.T) {
+	aggregatortest.RunErrorKinds(t, aggregatortest.Config{
+		New: func(t *testing.T, client *http.Client) api.Aggregator {
+			sut, err := weatherapi.DebuggingCaller("secret", nil, client, time.Now)
+			if err != nil {
+				t.Fatalf("creating DebuggingCaller: %+v", err)
+			}
+			return sut
+		},
+		Secret: "secret",
+	}, []aggregatortest.ErrorCase{
+		{
+			Name:   "invalid key",
+			Status: http.StatusUnauthorized,
+			Body:   `{"error":{"code":2006,"message":"API key provided is invalid"}}`,
+			Kind:   aggregator.KindAuth,
+		},
+		{
+			Name:   "quota exceeded",
+			Status: http.StatusForbidden,
+			Body:   `{"error":{"code":2007,"message":"API key has exceeded calls per month quota."}}`,
+			Kind:   aggregator.KindRateLimited,
+		},
+		{
+			Name:   "unknown location",
+			Status: http.StatusBadRequest,
+			Body:   `{"error":{"code":1006,"message":"No matching location found."}}`,
+			Kind:   aggregator.KindInvalidLocation,
+		},
+	})
+}
+
+// TestBaseURL verifies the caller talks to a configured stand-in below its path
+// prefix instead of the public API.
+func TestBaseURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mirror/v1/forecast.json" || r.URL.Query().Get("key") != "secret" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"forecast":{"forecastday":[{"date":"2024-11-05","day":{"maxtemp_c":19.8}}]}}`))
+	}))
+	t.Cleanup(srv.Close)
 
-	if res == empty {
-		return empty, errors.New("envvar WAPI_KEY has empty value")
+	base, err := url.Parse(srv.URL + "/mirror")
+	if err != nil {
+		t.Fatalf("parse base URL: %+v", err)
+	}
+	sut, err := weatherapi.DebuggingCaller("secret", base, srv.Client(), time.Now)
+	if err != nil {
+		t.Errorf("creating DebuggingCaller: %+v", err)
+		t.Fatal("Aborting")
+	}
+
+	got, err := sut.AggregateWeather(context.Background(), types.Query{
+		Lat:       42.6493934,
+		Lon:       -8.8201753,
+		Days:      1,
+		Variables: []types.Variable{types.VarMaxTemp},
+	})
+	if err != nil {
+		t.Fatalf("aggregate from stand-in: %+v", err)
 	}
 
-	return res, nil
+	want := types.DailyForecast{{Date: "2024-11-05", MaxTemp: 19.8}}
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("output mismatch, see diff")
+	}
 }
@@ -1,11 +1,62 @@
 package api
 
-import "github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+import (
+	"context"
+	"slices"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
 
 /*
 Aggregator interface implementation is the input port for weather data from
 any resource like OpenMeteo, WeatherAPI, OpenWeatherMap, MeteoGalicia and others.
+
+The context is the one of the incoming request. Implementations must pass it to
+their outgoing calls, so a cancelled or timed out request stops them, and
+return an *aggregator.CanceledError once it is done.
+
+MaxForecastDays reports the horizon of the resource. Queries asking for more
+days must be answered with an *aggregator.HorizonError.
 */
 type Aggregator interface {
-	AggregateWeather(lat, lon float64) (types.FiveDayForecast, error)
+	AggregateWeather(ctx context.Context, q types.Query) (types.DailyForecast, error)
+	MaxForecastDays() int
+}
+
+/*
+HourlyAggregator is implemented by aggregators whose resource offers forecasts
+hour by hour. The horizon is taken from the Hours field of the query.
+
+Aggregators without hourly data are left out of the hourly responses.
+*/
+type HourlyAggregator interface {
+	AggregateHourly(ctx context.Context, q types.Query) (types.HourlyForecast, error)
+}
+
+/*
+VariableAggregator is implemented by aggregators whose resource lacks some of
+the variables, like the UV index. Variables lists the ones it has.
+
+The others are left out of the responses and the consensus instead of showing
+up as 0. Aggregators that don't implement it have all of them.
+*/
+type VariableAggregator interface {
+	Variables() []types.Variable
+}
+
+// supported returns the variables of vv the aggregator a has.
+func supported(a Aggregator, vv []types.Variable) []types.Variable {
+	va, ok := a.(VariableAggregator)
+	if !ok {
+		return vv
+	}
+
+	has := va.Variables()
+	res := make([]types.Variable, 0, len(vv))
+	for _, v := range vv {
+		if slices.Contains(has, v) {
+			res = append(res, v)
+		}
+	}
+	return res
 }
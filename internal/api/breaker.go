@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+)
+
+// breakerStates publishes the state of every provider's breaker, keyed by the
+// provider ID.
+var breakerStates = expvar.NewMap("breakers")
+
+// BreakerConfig holds the thresholds of the circuit breaker around a provider.
+// After Failures failed calls in a row the breaker opens and the provider isn't
+// asked anymore. After Cooldown a single trial call decides whether it closes
+// again. Zero Failures turns the breaker off.
+type BreakerConfig struct {
+	Failures int
+	Cooldown time.Duration
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed lets all calls pass, the provider works fine.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects all calls, the provider is considered down.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single trial call pass to see if the provider is
+	// back.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// ErrBreakerOpen is reported for providers that weren't asked as their breaker
+// is open.
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// breaker keeps failing providers from slowing down every request.
+type breaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	clock    func() time.Time
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func newBreaker(cfg BreakerConfig) *breaker {
+	return &breaker{cfg: cfg, clock: time.Now}
+}
+
+// state reports the current state, which turns from open to half-open once the
+// cooldown is over.
+func (b *breaker) state() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stateLocked()
+}
+
+func (b *breaker) stateLocked() BreakerState {
+	if b.failures < b.cfg.Failures {
+		return BreakerClosed
+	}
+	if b.clock().Sub(b.openedAt) < b.cfg.Cooldown {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+// allow tells if the provider may be called. In half-open state only a single
+// trial call is allowed at a time. Rejected calls get a *aggregator.ProviderError
+// wrapping ErrBreakerOpen, with the rest of the cooldown as RetryAfter.
+func (b *breaker) allow(provider string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.stateLocked() {
+	case BreakerClosed:
+		return nil
+	case BreakerHalfOpen:
+		if !b.trial {
+			b.trial = true
+			return nil
+		}
+	}
+
+	return &aggregator.ProviderError{
+		Provider:   provider,
+		Kind:       aggregator.KindUnavailable,
+		RetryAfter: max(b.cfg.Cooldown-b.clock().Sub(b.openedAt), 0),
+		Err:        ErrBreakerOpen,
+	}
+}
+
+// record counts the outcome of an allowed call. Failures of the client, like
+// asking beyond the horizon or walking away, say nothing about the provider and
+// are left out.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	if !providerFault(err) {
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.cfg.Failures {
+		// Opens the breaker, or opens it once more after a failed trial.
+		b.openedAt = b.clock()
+	}
+}
+
+// providerFault tells if the error err is the fault of the provider.
+// Providers sparing their quota didn't even call their upstream API.
+func providerFault(err error) bool {
+	var hErr *aggregator.HorizonError
+	if errors.As(err, &hErr) {
+		return false
+	}
+	if errors.Is(err, aggregator.ErrQuotaExhausted) {
+		return false
+	}
+
+	var cErr *aggregator.CanceledError
+	if errors.As(err, &cErr) {
+		return cErr.Timeout()
+	}
+
+	var pErr *aggregator.ProviderError
+	if errors.As(err, &pErr) {
+		return pErr.Kind != aggregator.KindInvalidLocation
+	}
+	return !errors.Is(err, context.Canceled)
+}
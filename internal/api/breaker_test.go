@@ -0,0 +1,219 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// flakyAggregator fails as long as failing is set and counts its calls.
+type flakyAggregator struct {
+	stubAggregator
+	calls   atomic.Int32
+	failing atomic.Bool
+}
+
+func (f *flakyAggregator) AggregateWeather(ctx context.Context, q types.Query) (types.DailyForecast, error) {
+	f.calls.Add(1)
+	if f.failing.Load() {
+		return nil, errors.New("upstream down")
+	}
+	return f.stubAggregator.AggregateWeather(ctx, q)
+}
+
+type breakerStatus struct {
+	OK         bool   `json:"ok"`
+	ErrorClass string `json:"error_class"`
+	Breaker    string `json:"breaker"`
+}
+
+// flakyStatus requests the forecast and returns the status of the provider
+// "flaky".
+func flakyStatus(t *testing.T, srv *httptest.Server) breakerStatus {
+	t.Helper()
+
+	resp, err := srv.Client().Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&days=1", srv.URL))
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Providers map[string]struct {
+			Status breakerStatus `json:"status"`
+		} `json:"providers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to unmarshal API response data, got %+v", err)
+		t.Fatal("Can't verify response integrity, aborting!")
+	}
+	return result.Providers["flaky"].Status
+}
+
+// breakerVar reads the state of the breaker of provider id from /debug/vars.
+func breakerVar(t *testing.T, srv *httptest.Server, id string) string {
+	t.Helper()
+
+	resp, err := srv.Client().Get(srv.URL + "/debug/vars")
+	if err != nil {
+		t.Fatalf("Request expvars: %+v", err)
+	}
+	defer resp.Body.Close()
+
+	var vars struct {
+		Breakers map[string]string `json:"breakers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatalf("Unable to unmarshal expvars, got %+v", err)
+	}
+	return vars.Breakers[id]
+}
+
+func TestBreaker_OpensAndRecovers(t *testing.T) {
+	flaky := &flakyAggregator{stubAggregator: stubAggregator{maxDays: 14, maxTemp: 22}}
+	flaky.failing.Store(true)
+
+	providers := api.NewRegistry()
+	pp := []api.Provider{
+		{ID: "openmeteo", Name: "Open-Meteo Stub", Aggregator: stubAggregator{maxDays: 16, maxTemp: 20}},
+		{
+			ID:         "flaky",
+			Name:       "Flaky Stub",
+			Breaker:    api.BreakerConfig{Failures: 2, Cooldown: 100 * time.Millisecond},
+			Aggregator: flaky,
+		},
+	}
+	for _, p := range pp {
+		if err := providers.Register(p); err != nil {
+			t.Fatalf("register %s stub: %+v", p.ID, err)
+		}
+	}
+
+	sut := api.NewServer(api.Config{Providers: providers})
+	srv := httptest.NewServer(sut.Handler())
+	t.Cleanup(srv.Close)
+
+	if got := flakyStatus(t, srv); got.Breaker != "closed" || got.ErrorClass != "upstream" {
+		t.Errorf("First failure must keep the breaker closed, got %+v", got)
+	}
+	if got := flakyStatus(t, srv); got.Breaker != "open" || got.ErrorClass != "upstream" {
+		t.Errorf("Second failure must open the breaker, got %+v", got)
+	}
+	if got := breakerVar(t, srv, "flaky"); got != "open" {
+		t.Errorf("Open breaker must show up in the expvars, got %#v", got)
+	}
+
+	if got := flakyStatus(t, srv); got.Breaker != "open" || got.ErrorClass != "circuit_open" {
+		t.Errorf("Open breaker must fail fast, got %+v", got)
+	}
+	if got := flaky.calls.Load(); got != 2 {
+		t.Errorf("Open breaker must not call the provider, got %d calls", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if got := breakerVar(t, srv, "flaky"); got != "half_open" {
+		t.Errorf("Breaker must be half-open after the cooldown, got %#v", got)
+	}
+
+	flaky.failing.Store(false)
+	if got := flakyStatus(t, srv); !got.OK || got.Breaker != "closed" {
+		t.Errorf("Successful trial must close the breaker, got %+v", got)
+	}
+}
+
+// TestBreaker_ExhaustedQuotaKeepsClosed verifies a provider sparing its quota
+// isn't taken for a broken one.
+func TestBreaker_ExhaustedQuotaKeepsClosed(t *testing.T) {
+	providers := api.NewRegistry()
+	pp := []api.Provider{
+		{ID: "openmeteo", Name: "Open-Meteo Stub", Aggregator: stubAggregator{maxDays: 16, maxTemp: 20}},
+		{
+			ID:      "flaky",
+			Name:    "Quota Stub",
+			Breaker: api.BreakerConfig{Failures: 2, Cooldown: time.Minute},
+			Aggregator: stubAggregator{maxDays: 14, err: &aggregator.ProviderError{
+				Provider:   "flaky",
+				Kind:       aggregator.KindRateLimited,
+				RetryAfter: time.Hour,
+				Err:        fmt.Errorf("%w: 999000 of 1000000 calls used", aggregator.ErrQuotaExhausted),
+			}},
+		},
+	}
+	for _, p := range pp {
+		if err := providers.Register(p); err != nil {
+			t.Fatalf("register %s stub: %+v", p.ID, err)
+		}
+	}
+
+	sut := api.NewServer(api.Config{Providers: providers})
+	srv := httptest.NewServer(sut.Handler())
+	t.Cleanup(srv.Close)
+
+	for i := range 3 {
+		if got := flakyStatus(t, srv); got.Breaker != "closed" || got.ErrorClass != "quota_exhausted" {
+			t.Errorf("Request %d: exhausted quota must keep the breaker closed, got %+v", i+1, got)
+		}
+	}
+	if got := breakerVar(t, srv, "flaky"); got != "closed" {
+		t.Errorf("Exhausted quota must keep the breaker closed in the expvars, got %#v", got)
+	}
+}
+
+func TestBreaker_OpenRequiredProviderFailsFast(t *testing.T) {
+	flaky := &flakyAggregator{stubAggregator: stubAggregator{maxDays: 14}}
+	flaky.failing.Store(true)
+
+	providers := api.NewRegistry()
+	err := providers.Register(api.Provider{
+		ID:         "flaky",
+		Name:       "Flaky Stub",
+		Breaker:    api.BreakerConfig{Failures: 1, Cooldown: time.Minute},
+		Aggregator: flaky,
+	})
+	if err != nil {
+		t.Fatalf("register stub: %+v", err)
+	}
+
+	sut := api.NewServer(api.Config{Providers: providers})
+	srv := httptest.NewServer(sut.Handler())
+	t.Cleanup(srv.Close)
+
+	uri := fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&require=flaky", srv.URL)
+	for range 2 {
+		resp, err := srv.Client().Get(uri)
+		if err != nil {
+			t.Fatalf("Request to internal test server without response, got %+v.", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := srv.Client().Get(uri)
+	if err != nil {
+		t.Fatalf("Request to internal test server without response, got %+v.", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Open breaker must respond %s, got %s",
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusText(resp.StatusCode),
+		)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("Open breaker must tell when to retry")
+	}
+	if got := flaky.calls.Load(); got != 1 {
+		t.Errorf("Open breaker must not call the provider, got %d calls", got)
+	}
+}
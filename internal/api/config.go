@@ -1,10 +1,21 @@
 package api
 
-import "log/slog"
+import (
+	"log/slog"
+	"time"
+)
 
 // Config for the API server.
 // It differs from the application config as it requires a logger but not host.
+// The providers are set up by the application, so the server doesn't need to
+// know about their settings like API keys.
 type Config struct {
-	WeatherApiKey string
-	Logger        *slog.Logger
+	Providers *Registry
+	Logger    *slog.Logger
+	// Strategies adds consensus strategies to the built-in mean, median and
+	// trimmed ones, or replaces them, keyed by their `strategy` parameter.
+	Strategies map[string]Strategy
+	// RequestTimeout is the overall deadline of a forecast request, no matter
+	// how long the providers may take. Zero means no deadline.
+	RequestTimeout time.Duration
 }
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"slices"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/units"
+)
+
+// consensusResponse is the JSON representation of the combined forecast of
+// all aggregators, one entry per day.
+type consensusResponse struct {
+	Strategy string         `json:"strategy"`
+	Days     []consensusDay `json:"days"`
+}
+
+// consensusDay holds the combined values of one day, keyed by variable.
+type consensusDay struct {
+	Date      string                            `json:"date"`
+	Variables map[types.Variable]consensusValue `json:"variables"`
+}
+
+// consensusValue holds the combination of one variable of one day.
+// Value is the result of the selected strategy, the others are there to judge
+// how much the aggregators agree.
+type consensusValue struct {
+	Value  float32 `json:"value"`
+	Mean   float32 `json:"mean"`
+	Median float32 `json:"median"`
+	Min    float32 `json:"min"`
+	Max    float32 `json:"max"`
+	Spread float32 `json:"spread"`
+	Count  int     `json:"count"`
+}
+
+// combinable lists the variables a consensus makes sense for. Directions can't
+// be averaged like this, times and conditions not at all.
+var combinable = []types.Variable{
+	types.VarMaxTemp,
+	types.VarMinTemp,
+	types.VarPrecipitationSum,
+	types.VarPrecipitationProbability,
+	types.VarMaxWindSpeed,
+	types.VarMaxWindGust,
+	types.VarRelativeHumidity,
+	types.VarUVIndex,
+}
+
+// consensusPart is the forecast of one aggregator along with the requested
+// variables it has values of.
+type consensusPart struct {
+	forecast  types.DailyForecast
+	variables []types.Variable
+}
+
+// dayPart is the forecast of one aggregator for a single day.
+type dayPart struct {
+	forecast  types.Forecast
+	variables []types.Variable
+}
+
+// buildConsensus combines the forecasts pp of all aggregators day by day with
+// the strategy st. Only the combinable ones of the requested variables vv are
+// part of it, in the units u of the response. Each variable is combined from
+// the aggregators that have it.
+func buildConsensus(name string, st Strategy, pp []consensusPart, vv []types.Variable, u units.System) *consensusResponse {
+	byDate := make(map[string][]dayPart)
+	for _, p := range pp {
+		for _, d := range p.forecast {
+			byDate[d.Date] = append(byDate[d.Date], dayPart{forecast: d, variables: p.variables})
+		}
+	}
+
+	dates := make([]string, 0, len(byDate))
+	for d := range byDate {
+		dates = append(dates, d)
+	}
+	// ISO 8601 dates sort chronologically as strings.
+	slices.Sort(dates)
+
+	res := consensusResponse{Strategy: name, Days: make([]consensusDay, 0, len(dates))}
+	for _, date := range dates {
+		day := consensusDay{Date: date, Variables: make(map[types.Variable]consensusValue)}
+		for _, v := range vv {
+			if !slices.Contains(combinable, v) {
+				continue
+			}
+
+			values := make([]float64, 0, len(byDate[date]))
+			for _, p := range byDate[date] {
+				if slices.Contains(p.variables, v) {
+					values = append(values, float64(numericValue(p.forecast, v, u)))
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			day.Variables[v] = combine(st, values)
+		}
+		res.Days = append(res.Days, day)
+	}
+	return &res
+}
+
+// combine calculates the statistics of the values vv, which must not be empty.
+func combine(st Strategy, vv []float64) consensusValue {
+	low, high := slices.Min(vv), slices.Max(vv)
+	return consensusValue{
+		Value:  float32(st.Combine(vv)),
+		Mean:   float32(Mean{}.Combine(vv)),
+		Median: float32(Median{}.Combine(vv)),
+		Min:    float32(low),
+		Max:    float32(high),
+		Spread: float32(high - low),
+		Count:  len(vv),
+	}
+}
+
+// numericValue returns the value of the combinable variable v in the units u.
+func numericValue(f types.Forecast, v types.Variable, u units.System) float32 {
+	switch v {
+	case types.VarMaxTemp:
+		return u.Temperature.FromCelsius(f.MaxTemp)
+	case types.VarMinTemp:
+		return u.Temperature.FromCelsius(f.MinTemp)
+	case types.VarPrecipitationSum:
+		return u.Precipitation.FromMillimeters(f.PrecipitationSum)
+	case types.VarPrecipitationProbability:
+		return f.PrecipitationProbability
+	case types.VarMaxWindSpeed:
+		return u.Speed.FromKilometersPerHour(f.MaxWindSpeed)
+	case types.VarMaxWindGust:
+		return u.Speed.FromKilometersPerHour(f.MaxWindGust)
+	case types.VarRelativeHumidity:
+		return f.RelativeHumidity
+	case types.VarUVIndex:
+		return f.UVIndex
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Provider is an Aggregator registered under a stable ID like "openmeteo".
+// The ID keys its forecasts in the responses, so it must never change once
+// clients rely on it. Name and Attribution are shown next to the forecasts, as
+// most providers require to credit them.
+// Timeout limits how long a request waits for the provider, zero means it waits
+// as long as the request lasts. Breaker sets up the circuit breaker that stops
+// asking the provider while it keeps failing.
+type Provider struct {
+	ID             string
+	Name           string
+	Attribution    string
+	AttributionURL string
+	Timeout        time.Duration
+	Breaker        BreakerConfig
+	Aggregator     Aggregator
+
+	// circuit is the breaker set up on registration, shared by all copies.
+	circuit *breaker
+}
+
+// Registry holds the providers the server asks for forecasts.
+// They are asked in the order of their registration.
+//
+// It replaces the lazily initialized package globals, so registering happens
+// explicitly during startup and is safe even while requests are served.
+type Registry struct {
+	mu        sync.RWMutex
+	providers []Provider
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the provider p.
+// IDs must be unique and non-empty, as they identify the provider later on.
+func (r *Registry) Register(p Provider) error {
+	if p.ID == "" {
+		return fmt.Errorf("register provider without id")
+	}
+	if p.Aggregator == nil {
+		return fmt.Errorf("register provider %s without aggregator", p.ID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, q := range r.providers {
+		if q.ID == p.ID {
+			return fmt.Errorf("provider %s already registered", p.ID)
+		}
+	}
+
+	if p.Breaker.Failures > 0 {
+		p.circuit = newBreaker(p.Breaker)
+		circuit := p.circuit
+		breakerStates.Set(p.ID, expvar.Func(func() any {
+			return circuit.state()
+		}))
+	}
+	r.providers = append(r.providers, p)
+	return nil
+}
+
+// Providers returns a copy of the registered providers in order.
+func (r *Registry) Providers() []Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]Provider, len(r.providers))
+	copy(res, r.providers)
+	return res
+}
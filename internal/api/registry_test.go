@@ -0,0 +1,47 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+)
+
+func TestRegistry_KeepsRegistrationOrder(t *testing.T) {
+	sut := stubProviders(t)
+
+	pp := sut.Providers()
+	if len(pp) != 2 {
+		t.Fatalf("Registry must return all providers, got %d", len(pp))
+	}
+	if pp[0].ID != "openmeteo" || pp[1].ID != "weatherapi" {
+		t.Errorf("Registry must keep registration order, got %s, %s", pp[0].ID, pp[1].ID)
+	}
+}
+
+func TestRegistry_RejectsDuplicateIDs(t *testing.T) {
+	sut := stubProviders(t)
+
+	if err := sut.Register(api.Provider{ID: "openmeteo", Aggregator: stubAggregator{maxDays: 1}}); err == nil {
+		t.Error("Registering an ID twice must fail")
+	}
+	if err := sut.Register(api.Provider{Aggregator: stubAggregator{maxDays: 1}}); err == nil {
+		t.Error("Registering without ID must fail")
+	}
+	if err := sut.Register(api.Provider{ID: "nil"}); err == nil {
+		t.Error("Registering without aggregator must fail")
+	}
+}
+
+func TestRegistry_ProvidersReturnsCopy(t *testing.T) {
+	sut := api.NewRegistry()
+	if err := sut.Register(api.Provider{ID: "stub", Aggregator: stubAggregator{maxDays: 1}}); err != nil {
+		t.Fatalf("register stub: %+v", err)
+	}
+
+	pp := sut.Providers()
+	pp[0].ID = "changed"
+
+	if got := sut.Providers()[0].ID; got != "stub" {
+		t.Errorf("Modifying the returned providers must not change the registry, got %s", got)
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+)
+
+// requirement decides when a request counts as failed. It is taken from the
+// `require` parameter: all, any or the ID of a single provider.
+type requirement string
+
+const (
+	requireAll requirement = "all"
+	requireAny requirement = "any"
+)
+
+// defaultRequirement serves whatever the providers came up with, as partial
+// results are more helpful than none.
+const defaultRequirement = requireAny
+
+// parseRequirement parses the optional require parameter p. Provider IDs must
+// be among the providers pp.
+func parseRequirement(p string, pp []Provider) (requirement, error) {
+	switch requirement(p) {
+	case "":
+		return defaultRequirement, nil
+	case requireAll, requireAny:
+		return requirement(p), nil
+	}
+
+	for _, provider := range pp {
+		if provider.ID == p {
+			return requirement(p), nil
+		}
+	}
+	return "", fmt.Errorf("require unknown provider %#v", p)
+}
+
+// outcome is the result of asking one provider, successful or not.
+type outcome[T any] struct {
+	provider Provider
+	result   T
+	err      error
+	latency  time.Duration
+}
+
+// ask calls all providers at once and collects the outcomes in the order of pp.
+// A slow provider only holds up the response until its timeout.
+func ask[T any](ctx context.Context, pp []Provider, call func(context.Context, Provider) (T, error)) []outcome[T] {
+	res := make([]outcome[T], len(pp))
+
+	var wg sync.WaitGroup
+	for i, p := range pp {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res[i] = askOne(ctx, p, call)
+		}()
+	}
+	wg.Wait()
+
+	return res
+}
+
+// askOne calls the provider p within its timeout. It doesn't wait for
+// aggregators that ignore the context, so they can't hold up the response.
+func askOne[T any](ctx context.Context, p Provider, call func(context.Context, Provider) (T, error)) outcome[T] {
+	if p.circuit != nil {
+		if err := p.circuit.allow(p.ID); err != nil {
+			return outcome[T]{provider: p, err: err}
+		}
+	}
+
+	cancel := func() {}
+	if p.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+	}
+	defer cancel()
+
+	start := time.Now()
+	// Buffered, so the call finishes even if nobody waits for it anymore.
+	done := make(chan outcome[T], 1)
+	go func() {
+		// A panicking aggregator would take down the whole server, as this isn't
+		// the goroutine of the request anymore.
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome[T]{provider: p, err: &aggregator.ProviderError{
+					Provider: p.ID,
+					Err:      fmt.Errorf("panic: %v", r),
+				}}
+			}
+		}()
+
+		r, err := call(ctx, p)
+		done <- outcome[T]{provider: p, result: r, err: err}
+	}()
+
+	var res outcome[T]
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res = outcome[T]{provider: p, err: aggregator.Canceled(ctx, p.ID)}
+	}
+	res.latency = time.Since(start)
+
+	if p.circuit != nil {
+		p.circuit.record(res.err)
+	}
+	return res
+}
+
+// failed returns the outcome that makes the whole request fail according to
+// the requirement req. It reports false if the request succeeded.
+func failed[T any](req requirement, oo []outcome[T]) (outcome[T], bool) {
+	var first outcome[T]
+	var failures int
+	for _, o := range oo {
+		if o.err == nil {
+			continue
+		}
+		if failures == 0 {
+			first = o
+		}
+		failures++
+
+		if req == requireAll || requirement(o.provider.ID) == req {
+			return o, true
+		}
+	}
+
+	if req == requireAny && failures > 0 && failures == len(oo) {
+		return first, true
+	}
+	return first, false
+}
+
+// providerStatus reports how a provider did on the request.
+// Breaker is only set for providers with a circuit breaker. Skipped flags
+// providers that weren't asked at all to protect them, like an open breaker or
+// an exhausted quota.
+type providerStatus struct {
+	OK         bool         `json:"ok"`
+	Skipped    bool         `json:"skipped,omitempty"`
+	ErrorClass string       `json:"error_class,omitempty"`
+	Message    string       `json:"message,omitempty"`
+	LatencyMS  int64        `json:"latency_ms"`
+	Breaker    BreakerState `json:"breaker,omitempty"`
+}
+
+// statusOf summarizes the outcome o for the response.
+func statusOf[T any](o outcome[T]) providerStatus {
+	res := providerStatus{OK: o.err == nil, LatencyMS: o.latency.Milliseconds()}
+	if o.provider.circuit != nil {
+		res.Breaker = o.provider.circuit.state()
+	}
+	if o.err != nil {
+		res.Skipped = skipped(o.err)
+		res.ErrorClass = errorClass(o.err)
+		res.Message = o.err.Error()
+	}
+	return res
+}
+
+// skipped tells if the provider wasn't asked at all, as asking it would only
+// make things worse.
+func skipped(err error) bool {
+	return errors.Is(err, ErrBreakerOpen) || errors.Is(err, aggregator.ErrQuotaExhausted)
+}
+
+// errorClass sorts the error of a provider into a class clients can act on.
+func errorClass(err error) string {
+	var hErr *aggregator.HorizonError
+	if errors.As(err, &hErr) {
+		return "horizon"
+	}
+
+	var cErr *aggregator.CanceledError
+	if errors.As(err, &cErr) {
+		if cErr.Timeout() {
+			return string(aggregator.KindTimeout)
+		}
+		return "cancelled"
+	}
+
+	if errors.Is(err, ErrBreakerOpen) {
+		return "circuit_open"
+	}
+	if errors.Is(err, aggregator.ErrQuotaExhausted) {
+		return "quota_exhausted"
+	}
+
+	var pErr *aggregator.ProviderError
+	if errors.As(err, &pErr) && pErr.Kind != "" {
+		return string(pErr.Kind)
+	}
+
+	return "upstream"
+}
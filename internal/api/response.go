@@ -0,0 +1,148 @@
+package api
+
+import (
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/units"
+)
+
+// schemaVersion is the version of the JSON schemas in the schemas directory.
+// Adding optional fields keeps it, any other change requires a new version and
+// new schema files next to the old ones.
+const schemaVersion = "1"
+
+// weatherResponse is the JSON representation of the weather endpoints.
+// It states the units of all values next to the forecasts keyed by the stable
+// provider IDs. The daily forecasts come with the consensus of all providers.
+type weatherResponse[T any] struct {
+	SchemaVersion string                         `json:"schema_version"`
+	Schema        string                         `json:"schema"`
+	Units         units.System                   `json:"units"`
+	Providers     map[string]providerResponse[T] `json:"providers"`
+	Consensus     *consensusResponse             `json:"consensus,omitempty"`
+}
+
+// providerResponse holds the forecast of one provider along with the credits
+// it asks for and its status. Failed providers come without forecast.
+type providerResponse[T any] struct {
+	Name           string         `json:"name"`
+	Attribution    string         `json:"attribution"`
+	AttributionURL string         `json:"attribution_url,omitempty"`
+	Status         providerStatus `json:"status"`
+	Forecast       T              `json:"forecast,omitempty"`
+}
+
+// newProviderResponse wraps the encoded forecast f of the provider p.
+func newProviderResponse[T any](p Provider, st providerStatus, f T) providerResponse[T] {
+	return providerResponse[T]{
+		Name:           p.Name,
+		Attribution:    p.Attribution,
+		AttributionURL: p.AttributionURL,
+		Status:         st,
+		Forecast:       f,
+	}
+}
+
+// forecastResponse is the JSON representation of one forecast day.
+// The pointer fields let variables that weren't asked for vanish from the
+// output, while a real 0 value still shows up.
+type forecastResponse struct {
+	Date                     string
+	MaxTemp                  *float32         `json:",omitempty"`
+	MinTemp                  *float32         `json:",omitempty"`
+	PrecipitationSum         *float32         `json:",omitempty"`
+	PrecipitationProbability *float32         `json:",omitempty"`
+	MaxWindSpeed             *float32         `json:",omitempty"`
+	MaxWindGust              *float32         `json:",omitempty"`
+	WindDirection            *float32         `json:",omitempty"`
+	RelativeHumidity         *float32         `json:",omitempty"`
+	UVIndex                  *float32         `json:",omitempty"`
+	Sunrise                  *string          `json:",omitempty"`
+	Sunset                   *string          `json:",omitempty"`
+	Condition                *types.Condition `json:",omitempty"`
+}
+
+// hourResponse is the JSON representation of one forecast hour.
+type hourResponse struct {
+	Time                     string
+	Temp                     float32
+	Precipitation            float32
+	PrecipitationProbability float32
+	WindSpeed                float32
+	WindGust                 float32
+	WindDirection            float32
+	CloudCover               float32
+	Condition                types.Condition
+}
+
+// encodeDaily converts the forecast of an aggregator into its JSON
+// representation, keeping only the requested variables vv in the units u.
+// Sunrise and sunset are left out on days the aggregator has none.
+func encodeDaily(ff types.DailyForecast, vv []types.Variable, u units.System) []forecastResponse {
+	res := make([]forecastResponse, 0, len(ff))
+	for _, f := range ff {
+		r := forecastResponse{Date: f.Date}
+		for _, v := range vv {
+			switch v {
+			case types.VarMaxTemp:
+				r.MaxTemp = ptr(u.Temperature.FromCelsius(f.MaxTemp))
+			case types.VarMinTemp:
+				r.MinTemp = ptr(u.Temperature.FromCelsius(f.MinTemp))
+			case types.VarPrecipitationSum:
+				r.PrecipitationSum = ptr(u.Precipitation.FromMillimeters(f.PrecipitationSum))
+			case types.VarPrecipitationProbability:
+				r.PrecipitationProbability = &f.PrecipitationProbability
+			case types.VarMaxWindSpeed:
+				r.MaxWindSpeed = ptr(u.Speed.FromKilometersPerHour(f.MaxWindSpeed))
+			case types.VarMaxWindGust:
+				r.MaxWindGust = ptr(u.Speed.FromKilometersPerHour(f.MaxWindGust))
+			case types.VarWindDirection:
+				r.WindDirection = &f.WindDirection
+			case types.VarRelativeHumidity:
+				r.RelativeHumidity = &f.RelativeHumidity
+			case types.VarUVIndex:
+				r.UVIndex = &f.UVIndex
+			case types.VarSunrise:
+				r.Sunrise = optional(f.Sunrise)
+			case types.VarSunset:
+				r.Sunset = optional(f.Sunset)
+			case types.VarCondition:
+				r.Condition = &f.Condition
+			}
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// encodeHourly converts the hourly forecast of an aggregator into its JSON
+// representation in the units u.
+func encodeHourly(hh types.HourlyForecast, u units.System) []hourResponse {
+	res := make([]hourResponse, 0, len(hh))
+	for _, h := range hh {
+		res = append(res, hourResponse{
+			Time:                     h.Time,
+			Temp:                     u.Temperature.FromCelsius(h.Temp),
+			Precipitation:            u.Precipitation.FromMillimeters(h.Precipitation),
+			PrecipitationProbability: h.PrecipitationProbability,
+			WindSpeed:                u.Speed.FromKilometersPerHour(h.WindSpeed),
+			WindGust:                 u.Speed.FromKilometersPerHour(h.WindGust),
+			WindDirection:            h.WindDirection,
+			CloudCover:               h.CloudCover,
+			Condition:                h.Condition,
+		})
+	}
+	return res
+}
+
+// ptr returns a pointer to a copy of v for the optional response fields.
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// optional returns a pointer to a copy of s, or nil if s is empty.
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -1,16 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"expvar"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/units"
 )
 
 var reqs *expvar.Int
@@ -32,6 +38,46 @@ Please provide valid 'lat' and 'lon' in the URL.`
 const ParameterOutOfBoundsErrorDescription = `Parameters out of bounds.
 lat must be within -90 and 90, lon must be within -180 and 180.`
 
+const DaysParameterErrorDescription = `Invalid request parameter 'days'.
+days must be a whole number within 1 and 16.`
+
+const VariablesParameterErrorDescription = `Invalid request parameter 'variables'.
+variables must be a comma separated list of max_temp, min_temp, precipitation_sum,
+precipitation_probability, max_wind_speed, max_wind_gust, wind_direction,
+relative_humidity, uv_index, sunrise, sunset and condition.`
+
+const HoursParameterErrorDescription = `Invalid request parameter 'hours'.
+hours must be a whole number within 48 and 168.`
+
+const UnitsParameterErrorDescription = `Invalid unit request parameter(s).
+units must be metric, imperial or si. temp_unit may override it with C, F or K,
+wind_unit with kmh, ms, mph or kn and precip_unit with mm or in.`
+
+const StrategyParameterErrorDescription = `Invalid request parameter 'strategy'.
+strategy must be one of mean, median or trimmed.`
+
+const NoProvidersErrorDescription = `No weather providers available.
+Please enable at least one provider in the server configuration.`
+
+const RequireParameterErrorDescription = `Invalid request parameter 'require'.
+require must be all, any or the ID of a provider.`
+
+// defaultForecastDays keeps the response of clients that don't ask for a
+// specific horizon the way it used to be. maxForecastDays is the longest
+// horizon of any provider, beyond it every one of them would refuse.
+const (
+	defaultForecastDays = 5
+	maxForecastDays     = 16
+)
+
+// minForecastHours and maxForecastHours bound the hourly forecasts to
+// something between two days and a week, defaulting to two days.
+const (
+	minForecastHours     = 48
+	defaultForecastHours = minForecastHours
+	maxForecastHours     = 168
+)
+
 // addRoutes manages the endpoint routing for the API server.
 // Having all the information at one place might make navigating through the
 // server easier, as all the info you get is "this endpoint didn't work!"
@@ -41,6 +87,9 @@ func (s Server) addRoutes() {
 	// According to https://go.dev/blog/routing-enhancements the GET method also
 	// handles the HEAD method, so we don't need the HEAD routes.
 	mux.Handle("GET /weather", s.meterMiddleware(s.dataAggregation))
+	mux.Handle("GET /weather/hourly", s.meterMiddleware(s.hourlyAggregation))
+	mux.Handle("GET /conditions", s.meterMiddleware(s.conditions))
+	mux.Handle("GET /schemas/", schemaHandler())
 
 	mux.Handle("GET /debug/vars", expvar.Handler())
 }
@@ -87,9 +136,204 @@ func (s Server) meterMiddleware(inner func(http.ResponseWriter, *http.Request) e
 // dataAggregation verifies the request parameters, hooks up the aggregators and
 // responses with the aggregated data, or with error status and messages.
 func (s Server) dataAggregation(w http.ResponseWriter, r *http.Request) error {
-	transfer := make(map[string]types.FiveDayForecast)
+	params := r.URL.Query()
+	lat, lon, err := coordinates(w, params)
+	if err != nil {
+		return err
+	}
+
+	u, err := responseUnits(params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, UnitsParameterErrorDescription)
+		return fmt.Errorf("bad request: %w", err)
+	}
+	transfer := weatherResponse[[]forecastResponse]{
+		SchemaVersion: schemaVersion,
+		Schema:        dailySchemaPath,
+		Units:         u,
+		Providers:     make(map[string]providerResponse[[]forecastResponse]),
+	}
+
+	days, err := forecastDays(params.Get("days"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, DaysParameterErrorDescription)
+		return fmt.Errorf("bad request: %w", err)
+	}
+
+	variables, err := forecastVariables(params.Get("variables"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, VariablesParameterErrorDescription)
+		return fmt.Errorf("bad request: %w", err)
+	}
+
+	strategyName := params.Get("strategy")
+	if strategyName == "" {
+		strategyName = defaultStrategy
+	}
+	strategy, ok := s.strategies[strategyName]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, StrategyParameterErrorDescription)
+		return fmt.Errorf("bad request: unknown strategy %#v", strategyName)
+	}
+
+	pp := s.providers.Providers()
+	if len(pp) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, NoProvidersErrorDescription)
+		return errors.New("no providers registered")
+	}
+
+	req, err := parseRequirement(params.Get("require"), pp)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, RequireParameterErrorDescription)
+		return fmt.Errorf("bad request: %w", err)
+	}
+
+	ctx, cancel := s.withRequestTimeout(r.Context())
+	defer cancel()
+
+	q := types.Query{Lat: lat, Lon: lon, Days: days, Variables: variables}
+	oo := ask(ctx, pp, func(ctx context.Context, p Provider) (types.DailyForecast, error) {
+		// Providers that can't look that far ahead aren't asked at all.
+		if limit := p.Aggregator.MaxForecastDays(); days > limit {
+			return nil, &aggregator.HorizonError{
+				Provider:  p.ID,
+				Max:       limit,
+				Requested: days,
+				Unit:      "days",
+			}
+		}
+		return p.Aggregator.AggregateWeather(ctx, q)
+	})
+	if o, ok := failed(req, oo); ok {
+		return writeAggregatorError(w, o.provider.ID, o.err)
+	}
+
+	parts := make([]consensusPart, 0, len(oo))
+	for _, o := range oo {
+		var f []forecastResponse
+		if o.err == nil {
+			has := supported(o.provider.Aggregator, variables)
+			f = encodeDaily(o.result, has, u)
+			parts = append(parts, consensusPart{forecast: o.result, variables: has})
+		} else {
+			s.logger.Warn("Provider failed, responding without it.",
+				slog.String("provider", o.provider.ID),
+				slog.Any("err", o.err),
+			)
+		}
 
+		transfer.Providers[o.provider.ID] = newProviderResponse(o.provider, statusOf(o), f)
+	}
+
+	transfer.Consensus = buildConsensus(strategyName, strategy, parts, variables, u)
+
+	return writeJSON(w, transfer)
+}
+
+// hourlyAggregation verifies the request parameters and responses with the
+// hourly forecasts of all aggregators that offer them.
+func (s Server) hourlyAggregation(w http.ResponseWriter, r *http.Request) error {
 	params := r.URL.Query()
+	lat, lon, err := coordinates(w, params)
+	if err != nil {
+		return err
+	}
+
+	u, err := responseUnits(params)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, UnitsParameterErrorDescription)
+		return fmt.Errorf("bad request: %w", err)
+	}
+	transfer := weatherResponse[[]hourResponse]{
+		SchemaVersion: schemaVersion,
+		Schema:        hourlySchemaPath,
+		Units:         u,
+		Providers:     make(map[string]providerResponse[[]hourResponse]),
+	}
+
+	hours, err := forecastHours(params.Get("hours"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, HoursParameterErrorDescription)
+		return fmt.Errorf("bad request: %w", err)
+	}
+
+	pp := s.providers.Providers()
+	if len(pp) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, NoProvidersErrorDescription)
+		return errors.New("no providers registered")
+	}
+
+	hourly := make([]Provider, 0, len(pp))
+	for _, p := range pp {
+		if _, ok := p.Aggregator.(HourlyAggregator); !ok {
+			s.logger.Debug("Aggregator without hourly forecasts skipped.", slog.String("provider", p.ID))
+			continue
+		}
+		hourly = append(hourly, p)
+	}
+
+	req, err := parseRequirement(params.Get("require"), hourly)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, RequireParameterErrorDescription)
+		return fmt.Errorf("bad request: %w", err)
+	}
+
+	ctx, cancel := s.withRequestTimeout(r.Context())
+	defer cancel()
+
+	q := types.Query{Lat: lat, Lon: lon, Hours: hours}
+	oo := ask(ctx, hourly, func(ctx context.Context, p Provider) (types.HourlyForecast, error) {
+		return p.Aggregator.(HourlyAggregator).AggregateHourly(ctx, q)
+	})
+	if o, ok := failed(req, oo); ok {
+		return writeAggregatorError(w, o.provider.ID, o.err)
+	}
+
+	for _, o := range oo {
+		var h []hourResponse
+		if o.err == nil {
+			h = encodeHourly(o.result, u)
+		} else {
+			s.logger.Warn("Provider failed, responding without it.",
+				slog.String("provider", o.provider.ID),
+				slog.Any("err", o.err),
+			)
+		}
+
+		transfer.Providers[o.provider.ID] = newProviderResponse(o.provider, statusOf(o), h)
+	}
+
+	return writeJSON(w, transfer)
+}
+
+// withRequestTimeout limits the context of a forecast request to the overall
+// deadline, if there is one configured.
+func (s Server) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.requestTimeout)
+}
+
+// conditions responses with the canonical weather conditions used in the
+// forecasts, so clients can look up descriptions and icons.
+func (s Server) conditions(w http.ResponseWriter, r *http.Request) error {
+	return writeJSON(w, types.AllConditions())
+}
+
+// coordinates parses the mandatory lat and lon parameters and verifies their
+// bounds. If that fails it already answered the request with a bad request.
+func coordinates(w http.ResponseWriter, params url.Values) (float64, float64, error) {
 	pLat := params.Get("lat")
 	pLon := params.Get("lon")
 
@@ -98,7 +342,7 @@ func (s Server) dataAggregation(w http.ResponseWriter, r *http.Request) error {
 		err := errors.New(MissingParameterErrorDescription)
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprint(w, err.Error())
-		return err
+		return 0, 0, err
 	}
 
 	lat, err := strconv.ParseFloat(pLat, 64)
@@ -106,46 +350,89 @@ func (s Server) dataAggregation(w http.ResponseWriter, r *http.Request) error {
 		extErr := fmt.Errorf("parse latitude parameter %#v into float: %w", lat, err)
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprint(w, extErr.Error())
-		return extErr
+		return 0, 0, extErr
 	}
 	lon, err := strconv.ParseFloat(pLon, 64)
 	if err != nil {
 		extErr := fmt.Errorf("parse longitude parameter %#v into float: %w", lon, err)
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprint(w, extErr.Error())
-		return extErr
+		return 0, 0, extErr
 	}
 
 	if !saneInputs(lat, lon) {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprint(w, ParameterOutOfBoundsErrorDescription)
-		return fmt.Errorf("bad request: lat or lon params out of bounds: %+#v", params)
+		return 0, 0, fmt.Errorf("bad request: lat or lon params out of bounds: %+#v", params)
 	}
 
-	aa, err := s.aggregators()
-	if err != nil {
-		extErr := fmt.Errorf("receiving aggregators: %w", err)
+	return lat, lon, nil
+}
+
+// kindStatus maps the kinds of provider failures to the status codes of the
+// response. Failures of the upstream APIs are gateway errors, except for a bad
+// API key, as that's a misconfigured service. Rate limits are passed on to the
+// client, so it backs off as well.
+var kindStatus = map[aggregator.Kind]int{
+	aggregator.KindUnavailable:     http.StatusBadGateway,
+	aggregator.KindRateLimited:     http.StatusTooManyRequests,
+	aggregator.KindAuth:            http.StatusServiceUnavailable,
+	aggregator.KindDecode:          http.StatusBadGateway,
+	aggregator.KindInvalidLocation: http.StatusBadRequest,
+	aggregator.KindTimeout:         http.StatusGatewayTimeout,
+}
+
+// writeAggregatorError answers the request according to the error the
+// provider with the ID id returned.
+func writeAggregatorError(w http.ResponseWriter, id string, err error) error {
+	var hErr *aggregator.HorizonError
+	if errors.As(err, &hErr) {
+		extErr := fmt.Errorf("Request provider %s rejected horizon: %w", id, err)
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprint(w, extErr.Error())
 		return extErr
 	}
 
-	for i, a := range aa {
-		key := fmt.Sprintf("weatherAPI%d", i)
-		part, err := a.AggregateWeather(lat, lon)
-		if err != nil {
-			extErr := fmt.Errorf("Request API %d failed: %+v", i, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprint(w, extErr.Error())
-			return extErr
-		}
+	var cErr *aggregator.CanceledError
+	if errors.As(err, &cErr) {
+		// The client is most likely gone already, so the status code only
+		// matters for deadlines of in-between proxies.
+		extErr := fmt.Errorf("Request provider %s cancelled: %w", id, err)
+		w.WriteHeader(http.StatusGatewayTimeout)
+		fmt.Fprint(w, extErr.Error())
+		return extErr
+	}
 
-		transfer[key] = part
+	var pErr *aggregator.ProviderError
+	if errors.As(err, &pErr) && pErr.Kind != "" {
+		extErr := fmt.Errorf("Request provider %s failed: %w", id, err)
+		if pErr.RetryAfter > 0 {
+			// Round up, so clients don't come back a moment too early.
+			secs := (pErr.RetryAfter + time.Second - 1) / time.Second
+			w.Header().Set("Retry-After", strconv.Itoa(int(secs)))
+		}
+		status := kindStatus[pErr.Kind]
+		if skipped(err) {
+			// Nothing went wrong upstream this time, the provider is just
+			// spared for now.
+			status = http.StatusServiceUnavailable
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, extErr.Error())
+		return extErr
 	}
 
-	data, err := json.Marshal(transfer)
+	extErr := fmt.Errorf("Request provider %s failed: %+v", id, err)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprint(w, extErr.Error())
+	return extErr
+}
+
+// writeJSON marshals the transfer object v and answers the request with it.
+func writeJSON(w http.ResponseWriter, v any) error {
+	data, err := json.Marshal(v)
 	if err != nil {
-		extErr := fmt.Errorf("Marshalling response %+v failed: %+v", transfer, err)
+		extErr := fmt.Errorf("Marshalling response %+v failed: %+v", v, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprint(w, extErr.Error())
 		return extErr
@@ -158,6 +445,96 @@ func (s Server) dataAggregation(w http.ResponseWriter, r *http.Request) error {
 	return err
 }
 
+// forecastDays parses the optional days parameter.
+// An empty parameter falls back to defaultForecastDays.
+func forecastDays(p string) (int, error) {
+	if p == "" {
+		return defaultForecastDays, nil
+	}
+
+	days, err := strconv.Atoi(p)
+	if err != nil {
+		return 0, fmt.Errorf("parse days parameter %#v into int: %w", p, err)
+	}
+	if days < 1 || days > maxForecastDays {
+		return 0, fmt.Errorf("days parameter %d out of bounds", days)
+	}
+	return days, nil
+}
+
+// forecastHours parses the optional hours parameter.
+// An empty parameter falls back to defaultForecastHours.
+func forecastHours(p string) (int, error) {
+	if p == "" {
+		return defaultForecastHours, nil
+	}
+
+	hours, err := strconv.Atoi(p)
+	if err != nil {
+		return 0, fmt.Errorf("parse hours parameter %#v into int: %w", p, err)
+	}
+	if hours < minForecastHours || hours > maxForecastHours {
+		return 0, fmt.Errorf("hours parameter %d out of bounds", hours)
+	}
+	return hours, nil
+}
+
+// responseUnits parses the optional units parameter and the per quantity
+// overrides temp_unit, wind_unit and precip_unit. It defaults to metric.
+func responseUnits(params url.Values) (units.System, error) {
+	res := units.Metric
+	if p := params.Get("units"); p != "" {
+		sys, err := units.ParseSystem(p)
+		if err != nil {
+			return res, err
+		}
+		res = sys
+	}
+
+	if p := params.Get("temp_unit"); p != "" {
+		t, err := units.ParseTemperature(p)
+		if err != nil {
+			return res, err
+		}
+		res.Temperature = t
+	}
+	if p := params.Get("wind_unit"); p != "" {
+		sp, err := units.ParseSpeed(p)
+		if err != nil {
+			return res, err
+		}
+		res.Speed = sp
+	}
+	if p := params.Get("precip_unit"); p != "" {
+		l, err := units.ParseLength(p)
+		if err != nil {
+			return res, err
+		}
+		res.Precipitation = l
+	}
+	return res, nil
+}
+
+// forecastVariables parses the optional comma separated variables parameter.
+// An empty parameter asks for all variables, duplicates are ignored.
+func forecastVariables(p string) ([]types.Variable, error) {
+	if p == "" {
+		return types.AllVariables, nil
+	}
+
+	var res []types.Variable
+	for _, name := range strings.Split(p, ",") {
+		v, ok := types.ParseVariable(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown variable %#v", name)
+		}
+		if !slices.Contains(res, v) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
 func saneInputs(lat, lon float64) bool {
 	switch {
 	case lat < -90.000000:
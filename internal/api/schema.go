@@ -0,0 +1,29 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// schemaFiles holds the published JSON schemas of the responses.
+// They are part of the API contract, so clients can validate against them.
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// The paths the schemas are served at, also stated in each response.
+const (
+	dailySchemaPath  = "/schemas/weather.v" + schemaVersion + ".json"
+	hourlySchemaPath = "/schemas/weather-hourly.v" + schemaVersion + ".json"
+)
+
+// schemaHandler serves the embedded schema files below /schemas/.
+func schemaHandler() http.Handler {
+	sub, err := fs.Sub(schemaFiles, "schemas")
+	if err != nil {
+		// The directory is embedded at compile time, so this can't happen.
+		panic(err)
+	}
+	return http.StripPrefix("/schemas/", http.FileServerFS(sub))
+}
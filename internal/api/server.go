@@ -1,12 +1,9 @@
 package api
 
 import (
-	"fmt"
 	"log/slog"
 	"net/http"
-
-	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/openmeteo"
-	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/weatherapi"
+	"time"
 )
 
 // Server holds all the information that the API server needs.
@@ -18,9 +15,11 @@ import (
 // Zet he's constantly updating it kinda each year like on the Grafana blog:
 // https://grafana.com/blog/2024/02/09/how-i-write-http-services-in-go-after-13-years/
 type Server struct {
-	logger        *slog.Logger
-	mux           *http.ServeMux
-	weatherapikey string
+	logger         *slog.Logger
+	mux            *http.ServeMux
+	providers      *Registry
+	strategies     map[string]Strategy
+	requestTimeout time.Duration
 }
 
 // NewServer returns an API server set up according to the configuration.
@@ -36,11 +35,22 @@ func NewServer(c Config) *Server {
 	// third-party package might manipulate it. Even a different package in this
 	// codebase. Prometheus for instance registers it's /metrics handler there.
 	// So creating a new ServeMux type prevents unexpected side effects.
+	providers := c.Providers
+	if providers == nil {
+		logger.Warn("NewServer called without providers, forecasts will be empty")
+		providers = NewRegistry()
+	}
+
 	mux := http.NewServeMux()
 	s := Server{
-		mux:           mux,
-		logger:        logger,
-		weatherapikey: c.WeatherApiKey,
+		mux:            mux,
+		logger:         logger,
+		providers:      providers,
+		strategies:     defaultStrategies(),
+		requestTimeout: c.RequestTimeout,
+	}
+	for name, st := range c.Strategies {
+		s.strategies[name] = st
 	}
 
 	s.addRoutes()
@@ -52,29 +62,3 @@ func NewServer(c Config) *Server {
 func (s Server) Handler() http.Handler {
 	return s.mux
 }
-
-// TODO: Extend new API aggregators here
-var meteo Aggregator
-var weather Aggregator
-
-// aggregators lazy-loads the registered aggregators for later use.
-// The lazy-loading approach is used to reduce startup time while increasing
-// duration of the first request. Might be helpful inside of Kubernetes.
-func (s Server) aggregators() ([]Aggregator, error) {
-	if meteo == nil {
-		meteo = openmeteo.NewCaller()
-	}
-	if weather == nil {
-		var err error
-		weather, err = weatherapi.NewCaller(s.weatherapikey)
-		if err != nil {
-			return nil, fmt.Errorf("initialize weatherapi caller: %w", err)
-		}
-	}
-
-	res := []Aggregator{
-		meteo,
-		weather,
-	}
-	return res, nil
-}
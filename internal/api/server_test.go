@@ -1,13 +1,20 @@
 package api_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
 )
 
 func TestGetNonExistingEndpoint_ReturnsNotFoundStatus(t *testing.T) {
@@ -70,6 +77,41 @@ func TestGetExpvarsEndpoint_ReturnsOKStatus(t *testing.T) {
 	}
 }
 
+func TestGetConditionsEndpoint_ListsCanonicalConditions(t *testing.T) {
+	sut := api.NewServer(api.Config{})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	resp, err := c.Get(fmt.Sprintf("%s/conditions", srv.URL))
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	got := resp.StatusCode
+	want := http.StatusOK
+
+	if got != want {
+		t.Errorf(
+			"Conditions endpoint must return %s, got %s",
+			http.StatusText(want),
+			http.StatusText(got),
+		)
+	}
+
+	var cc []types.ConditionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&cc); err != nil {
+		t.Errorf("Unable to unmarshal conditions, got %+v", err)
+		t.Fatalf("Can't verify response integrity, aborting!")
+	}
+
+	if !cmp.Equal(types.AllConditions(), cc) {
+		fmt.Println(cmp.Diff(types.AllConditions(), cc))
+		t.Error("Conditions endpoint must list all canonical conditions, see diff")
+	}
+}
+
 func TestGetWeatherEndpointWithoutParameters_ReturnsBadRequestStatus(t *testing.T) {
 	sut := api.NewServer(api.Config{})
 
@@ -161,8 +203,770 @@ func TestGetWeatherEndpointOutOfBounds_ReturnsBadRequestStatus(t *testing.T) {
 			}
 		})
 	}
+}
+
+type daysTestValues struct {
+	days       string
+	wantStatus int
+	// wantBody is the description of a rejected parameter, if any.
+	wantBody string
+}
+
+// TestGetWeatherEndpointInvalidDays_ReturnsBadRequestStatus covers the days
+// parameter and the provider horizons. Beyond the horizon of a single provider
+// the request only fails if that provider is required.
+func TestGetWeatherEndpointInvalidDays_ReturnsBadRequestStatus(t *testing.T) {
+	rr := []daysTestValues{
+		{days: "0", wantStatus: http.StatusBadRequest, wantBody: api.DaysParameterErrorDescription},
+		{days: "-3", wantStatus: http.StatusBadRequest, wantBody: api.DaysParameterErrorDescription},
+		{days: "five", wantStatus: http.StatusBadRequest, wantBody: api.DaysParameterErrorDescription},
+		{days: "15&require=all", wantStatus: http.StatusBadRequest},
+		{days: "15&require=weatherapi", wantStatus: http.StatusBadRequest},
+		{days: "17", wantStatus: http.StatusBadRequest, wantBody: api.DaysParameterErrorDescription},
+		{days: "100000&require=any", wantStatus: http.StatusBadRequest, wantBody: api.DaysParameterErrorDescription},
+	}
+
+	sut := api.NewServer(api.Config{Providers: stubProviders(t)})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	for _, r := range rr {
+		t.Run(fmt.Sprintf("days=%s", r.days), func(t *testing.T) {
+			uri := fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&days=%s", srv.URL, r.days)
+			resp, err := c.Get(uri)
+			if err != nil {
+				t.Errorf("Request to internal test server without response, got %+v.", err)
+				t.Fatal("This is bad. Really bad. Technically it should never happen.")
+			}
+
+			got := resp.StatusCode
+			want := r.wantStatus
+
+			if got != want {
+				t.Errorf(
+					"Weather endpoint days response mismatch, want %s, got %s",
+					http.StatusText(want),
+					http.StatusText(got),
+				)
+			}
+
+			if r.wantBody == "" {
+				return
+			}
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Read response body: %+v", err)
+			}
+			if string(data) != r.wantBody {
+				t.Errorf("Weather endpoint days body mismatch, want %q, got %q", r.wantBody, data)
+			}
+		})
+	}
+}
+
+type hoursTestValues struct {
+	hours      string
+	wantStatus int
+}
+
+func TestGetHourlyEndpointInvalidHours_ReturnsBadRequestStatus(t *testing.T) {
+	rr := []hoursTestValues{
+		{hours: "0", wantStatus: http.StatusBadRequest},
+		{hours: "47", wantStatus: http.StatusBadRequest},
+		{hours: "169", wantStatus: http.StatusBadRequest},
+		{hours: "two days", wantStatus: http.StatusBadRequest},
+	}
+
+	sut := api.NewServer(api.Config{Providers: stubProviders(t)})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	for _, r := range rr {
+		t.Run(fmt.Sprintf("hours=%s", r.hours), func(t *testing.T) {
+			uri := fmt.Sprintf(
+				"%s/weather/hourly?lat=42.6493934&lon=-8.8201753&hours=%s",
+				srv.URL, url.QueryEscape(r.hours),
+			)
+			resp, err := c.Get(uri)
+			if err != nil {
+				t.Errorf("Request to internal test server without response, got %+v.", err)
+				t.Fatal("This is bad. Really bad. Technically it should never happen.")
+			}
+
+			got := resp.StatusCode
+			want := r.wantStatus
+
+			if got != want {
+				t.Errorf(
+					"Hourly endpoint hours response mismatch, want %s, got %s",
+					http.StatusText(want),
+					http.StatusText(got),
+				)
+			}
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("Unable to read response data, got %+v", err)
+				t.Fatalf("Can't verify response integrity, aborting!")
+			}
+			if string(data) != api.HoursParameterErrorDescription {
+				t.Errorf(
+					"Hourly endpoint must return reasonable error description, got %#v",
+					string(data),
+				)
+			}
+		})
+	}
+}
+
+type unitsTestValues struct {
+	query      string
+	wantStatus int
+}
+
+func TestGetWeatherEndpointInvalidUnits_ReturnsBadRequestStatus(t *testing.T) {
+	rr := []unitsTestValues{
+		{query: "units=nautical", wantStatus: http.StatusBadRequest},
+		{query: "units=imperial&temp_unit=R", wantStatus: http.StatusBadRequest},
+		{query: "wind_unit=bft", wantStatus: http.StatusBadRequest},
+		{query: "precip_unit=cm", wantStatus: http.StatusBadRequest},
+	}
+
+	sut := api.NewServer(api.Config{Providers: stubProviders(t)})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	for _, r := range rr {
+		t.Run(r.query, func(t *testing.T) {
+			uri := fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&%s", srv.URL, r.query)
+			resp, err := c.Get(uri)
+			if err != nil {
+				t.Errorf("Request to internal test server without response, got %+v.", err)
+				t.Fatal("This is bad. Really bad. Technically it should never happen.")
+			}
+
+			got := resp.StatusCode
+			want := r.wantStatus
+
+			if got != want {
+				t.Errorf(
+					"Weather endpoint units response mismatch, want %s, got %s",
+					http.StatusText(want),
+					http.StatusText(got),
+				)
+			}
+
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("Unable to read response data, got %+v", err)
+				t.Fatalf("Can't verify response integrity, aborting!")
+			}
+			if string(data) != api.UnitsParameterErrorDescription {
+				t.Errorf(
+					"Weather endpoint must return reasonable error description, got %#v",
+					string(data),
+				)
+			}
+		})
+	}
+}
+
+func TestGetWeatherEndpointUnknownStrategy_ReturnsBadRequestStatus(t *testing.T) {
+	sut := api.NewServer(api.Config{Providers: stubProviders(t)})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	uri := fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&strategy=mode", srv.URL)
+	resp, err := c.Get(uri)
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	got := resp.StatusCode
+	want := http.StatusBadRequest
+
+	if got != want {
+		t.Errorf(
+			"Weather endpoint with unknown strategy must respond %s, got %s",
+			http.StatusText(want),
+			http.StatusText(got),
+		)
+	}
+}
+
+func TestGetWeatherEndpointWithoutProviders_ReturnsServiceUnavailableStatus(t *testing.T) {
+	sut := api.NewServer(api.Config{})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	resp, err := c.Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753", srv.URL))
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	got := resp.StatusCode
+	want := http.StatusServiceUnavailable
+
+	if got != want {
+		t.Errorf(
+			"Weather endpoint without providers must respond %s, got %s",
+			http.StatusText(want),
+			http.StatusText(got),
+		)
+	}
+}
+
+func TestGetWeatherEndpoint_ReturnsConsensus(t *testing.T) {
+	sut := api.NewServer(api.Config{Providers: stubProviders(t)})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	uri := fmt.Sprintf(
+		"%s/weather?lat=42.6493934&lon=-8.8201753&days=2&variables=max_temp&strategy=mean",
+		srv.URL,
+	)
+	resp, err := c.Get(uri)
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Weather endpoint must respond OK, got %s", http.StatusText(resp.StatusCode))
+	}
+
+	var result struct {
+		Consensus struct {
+			Strategy string `json:"strategy"`
+			Days     []struct {
+				Date      string                        `json:"date"`
+				Variables map[string]map[string]float64 `json:"variables"`
+			} `json:"days"`
+		} `json:"consensus"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to unmarshal API response data, got %+v", err)
+		t.Fatal("Can't verify response integrity, aborting!")
+	}
+
+	if result.Consensus.Strategy != "mean" {
+		t.Errorf("Consensus must name the strategy, got %#v", result.Consensus.Strategy)
+	}
+	if len(result.Consensus.Days) != 2 {
+		t.Fatalf("Consensus must hold one entry per day, got %d", len(result.Consensus.Days))
+	}
+
+	got := result.Consensus.Days[0].Variables["max_temp"]
+	want := map[string]float64{
+		"value": 21, "mean": 21, "median": 21, "min": 20, "max": 22, "spread": 2, "count": 2,
+	}
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("consensus mismatch, see diff")
+	}
+	if _, ok := result.Consensus.Days[0].Variables["min_temp"]; ok {
+		t.Error("Consensus must only contain the requested variables")
+	}
+}
+
+// partialAggregator is a stubAggregator lacking all but the variables.
+type partialAggregator struct {
+	stubAggregator
+	variables []types.Variable
+}
+
+func (p partialAggregator) Variables() []types.Variable {
+	return p.variables
+}
+
+// TestGetWeatherEndpoint_LeavesOutUnsupportedVariables verifies variables a
+// provider doesn't have are neither part of its forecast nor of the consensus,
+// just like sunrise and sunset on days without.
+func TestGetWeatherEndpoint_LeavesOutUnsupportedVariables(t *testing.T) {
+	providers := stubProviders(t)
+	err := providers.Register(api.Provider{
+		ID:   "partial",
+		Name: "Partial Stub",
+		Aggregator: partialAggregator{
+			stubAggregator: stubAggregator{maxDays: 9, maxTemp: 30},
+			variables:      []types.Variable{types.VarMaxTemp},
+		},
+	})
+	if err != nil {
+		t.Fatalf("register partial stub: %+v", err)
+	}
+
+	sut := api.NewServer(api.Config{Providers: providers})
+	srv := httptest.NewServer(sut.Handler())
+	t.Cleanup(srv.Close)
+
+	uri := fmt.Sprintf(
+		"%s/weather?lat=42.6493934&lon=-8.8201753&days=1&variables=max_temp,min_temp,sunrise&strategy=mean",
+		srv.URL,
+	)
+	resp, err := srv.Client().Get(uri)
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	var result struct {
+		Providers map[string]struct {
+			Forecast []map[string]any `json:"forecast"`
+		} `json:"providers"`
+		Consensus struct {
+			Days []struct {
+				Variables map[string]map[string]float64 `json:"variables"`
+			} `json:"days"`
+		} `json:"consensus"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to unmarshal API response data, got %+v", err)
+		t.Fatal("Can't verify response integrity, aborting!")
+	}
+
+	got := result.Providers["partial"].Forecast
+	want := []map[string]any{{"Date": "2024-11-05", "MaxTemp": 30.0}}
+	if !cmp.Equal(want, got) {
+		fmt.Println(cmp.Diff(want, got))
+		t.Error("forecast mismatch, see diff")
+	}
+	if _, ok := result.Providers["openmeteo"].Forecast[0]["Sunrise"]; ok {
+		t.Error("Forecast without sunrise must leave it out")
+	}
+
+	if len(result.Consensus.Days) != 1 {
+		t.Fatalf("Consensus must hold one entry per day, got %d", len(result.Consensus.Days))
+	}
+	vars := result.Consensus.Days[0].Variables
+	if got := vars["max_temp"]["count"]; got != 3 {
+		t.Errorf("Consensus of max_temp must count all 3 providers, got %g", got)
+	}
+	if got := vars["min_temp"]; got["count"] != 2 || got["mean"] != 13 {
+		t.Errorf("Consensus of min_temp must leave out the provider without, got %+v", got)
+	}
+}
+
+func TestGetWeatherEndpoint_KeysByProviderID(t *testing.T) {
+	sut := api.NewServer(api.Config{Providers: stubProviders(t)})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	resp, err := c.Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&days=1", srv.URL))
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Weather endpoint must respond OK, got %s", http.StatusText(resp.StatusCode))
+	}
+
+	var result struct {
+		SchemaVersion string `json:"schema_version"`
+		Schema        string `json:"schema"`
+		Providers     map[string]struct {
+			Name        string            `json:"name"`
+			Attribution string            `json:"attribution"`
+			Forecast    []json.RawMessage `json:"forecast"`
+		} `json:"providers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to unmarshal API response data, got %+v", err)
+		t.Fatal("Can't verify response integrity, aborting!")
+	}
+
+	if result.SchemaVersion != "1" {
+		t.Errorf("Response must state schema version 1, got %#v", result.SchemaVersion)
+	}
+	for _, id := range []string{"openmeteo", "weatherapi"} {
+		p, ok := result.Providers[id]
+		if !ok {
+			t.Errorf("Response must contain provider %s, got %+v", id, result.Providers)
+			continue
+		}
+		if p.Name == "" || p.Attribution == "" {
+			t.Errorf("Provider %s must come with name and attribution, got %+v", id, p)
+		}
+		if len(p.Forecast) != 1 {
+			t.Errorf("Provider %s must contain one day, got %d", id, len(p.Forecast))
+		}
+	}
+
+	schema, err := c.Get(srv.URL + result.Schema)
+	if err != nil {
+		t.Fatalf("Request schema %s: %+v", result.Schema, err)
+	}
+	if schema.StatusCode != http.StatusOK {
+		t.Errorf("Schema %s must be published, got %s", result.Schema, http.StatusText(schema.StatusCode))
+	}
+	var doc map[string]any
+	if err := json.NewDecoder(schema.Body).Decode(&doc); err != nil {
+		t.Errorf("Schema %s must be valid JSON, got %+v", result.Schema, err)
+	}
+}
+
+func TestGetWeatherEndpointUnknownVariable_ReturnsBadRequestStatus(t *testing.T) {
+	sut := api.NewServer(api.Config{Providers: stubProviders(t)})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	uri := fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&variables=max_temp,snow_depth", srv.URL)
+	resp, err := c.Get(uri)
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	got := resp.StatusCode
+	want := http.StatusBadRequest
+
+	if got != want {
+		t.Errorf(
+			"Weather endpoint with unknown variable must respond %s, got %s",
+			http.StatusText(want),
+			http.StatusText(got),
+		)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Errorf("Unable to read response data, got %+v", err)
+		t.Fatalf("Can't verify response integrity, aborting!")
+	}
+	if string(data) != api.VariablesParameterErrorDescription {
+		t.Errorf(
+			"Weather endpoint must return reasonable error description, got %#v",
+			string(data),
+		)
+	}
 } // Uncovered Test Case Ideas:
 //
 // Coordinates Boundary tests as they have limits:
 // lat:  -90.0000000000 --  90.000000000
 // lon: -180.0000000000 -- 180.000000000
+
+type requireTestValues struct {
+	require    string
+	wantStatus int
+}
+
+// TestGetWeatherEndpointFailingProvider_ReturnsPartialResults lets the
+// weatherapi stub fail and checks when that fails the whole request.
+func TestGetWeatherEndpointFailingProvider_ReturnsPartialResults(t *testing.T) {
+	rr := []requireTestValues{
+		{require: "", wantStatus: http.StatusOK},
+		{require: "any", wantStatus: http.StatusOK},
+		{require: "openmeteo", wantStatus: http.StatusOK},
+		{require: "all", wantStatus: http.StatusInternalServerError},
+		{require: "weatherapi", wantStatus: http.StatusInternalServerError},
+		{require: "nonexisting", wantStatus: http.StatusBadRequest},
+	}
+
+	providers := api.NewRegistry()
+	pp := []api.Provider{
+		{ID: "openmeteo", Name: "Open-Meteo Stub", Aggregator: stubAggregator{maxDays: 16, maxTemp: 20}},
+		{ID: "weatherapi", Name: "WeatherAPI Stub", Aggregator: stubAggregator{maxDays: 14, err: errors.New("upstream down")}},
+	}
+	for _, p := range pp {
+		if err := providers.Register(p); err != nil {
+			t.Fatalf("register %s stub: %+v", p.ID, err)
+		}
+	}
+
+	sut := api.NewServer(api.Config{Providers: providers})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	for _, r := range rr {
+		t.Run(fmt.Sprintf("require=%s", r.require), func(t *testing.T) {
+			uri := fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&days=2&require=%s", srv.URL, r.require)
+			resp, err := c.Get(uri)
+			if err != nil {
+				t.Errorf("Request to internal test server without response, got %+v.", err)
+				t.Fatal("This is bad. Really bad. Technically it should never happen.")
+			}
+
+			if resp.StatusCode != r.wantStatus {
+				t.Fatalf(
+					"Weather endpoint require response mismatch, want %s, got %s",
+					http.StatusText(r.wantStatus),
+					http.StatusText(resp.StatusCode),
+				)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			var result struct {
+				Providers map[string]struct {
+					Status struct {
+						OK         bool   `json:"ok"`
+						ErrorClass string `json:"error_class"`
+						Message    string `json:"message"`
+					} `json:"status"`
+					Forecast []json.RawMessage `json:"forecast"`
+				} `json:"providers"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Errorf("Unable to unmarshal API response data, got %+v", err)
+				t.Fatal("Can't verify response integrity, aborting!")
+			}
+
+			ok := result.Providers["openmeteo"]
+			if !ok.Status.OK || len(ok.Forecast) != 2 {
+				t.Errorf("Working provider must report OK with two days, got %+v", ok)
+			}
+
+			failed := result.Providers["weatherapi"]
+			if failed.Status.OK || failed.Status.ErrorClass != "upstream" || failed.Status.Message == "" {
+				t.Errorf("Failing provider must report its error, got %+v", failed.Status)
+			}
+			if len(failed.Forecast) != 0 {
+				t.Errorf("Failing provider must come without forecast, got %d days", len(failed.Forecast))
+			}
+		})
+	}
+}
+
+// TestGetWeatherEndpointSlowProvider_RespondsWithinTimeout lets the weatherapi
+// stub take way longer than its timeout and checks the openmeteo data arrives
+// in time anyway.
+func TestGetWeatherEndpointSlowProvider_RespondsWithinTimeout(t *testing.T) {
+	providers := api.NewRegistry()
+	pp := []api.Provider{
+		{ID: "openmeteo", Name: "Open-Meteo Stub", Aggregator: stubAggregator{maxDays: 16, maxTemp: 20}},
+		{
+			ID:         "weatherapi",
+			Name:       "WeatherAPI Stub",
+			Timeout:    50 * time.Millisecond,
+			Aggregator: stubAggregator{maxDays: 14, maxTemp: 22, delay: 2 * time.Second},
+		},
+	}
+	for _, p := range pp {
+		if err := providers.Register(p); err != nil {
+			t.Fatalf("register %s stub: %+v", p.ID, err)
+		}
+	}
+
+	sut := api.NewServer(api.Config{Providers: providers, RequestTimeout: time.Second})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	start := time.Now()
+	resp, err := c.Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&days=2", srv.URL))
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Weather endpoint must not wait for the slow provider, took %s", took)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Weather endpoint must respond OK, got %s", http.StatusText(resp.StatusCode))
+	}
+
+	var result struct {
+		Providers map[string]struct {
+			Status struct {
+				OK         bool   `json:"ok"`
+				ErrorClass string `json:"error_class"`
+			} `json:"status"`
+		} `json:"providers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to unmarshal API response data, got %+v", err)
+		t.Fatal("Can't verify response integrity, aborting!")
+	}
+
+	if !result.Providers["openmeteo"].Status.OK {
+		t.Errorf("Fast provider must report OK, got %+v", result.Providers["openmeteo"].Status)
+	}
+	if got := result.Providers["weatherapi"].Status.ErrorClass; got != "timeout" {
+		t.Errorf("Slow provider must report a timeout, got %#v", got)
+	}
+}
+
+// TestGetWeatherEndpointPanickingProvider_ReturnsPartialResults verifies a
+// panicking aggregator neither takes down the server nor the other providers.
+func TestGetWeatherEndpointPanickingProvider_ReturnsPartialResults(t *testing.T) {
+	providers := api.NewRegistry()
+	pp := []api.Provider{
+		{ID: "openmeteo", Name: "Open-Meteo Stub", Aggregator: stubAggregator{maxDays: 16, maxTemp: 20}},
+		{ID: "weatherapi", Name: "WeatherAPI Stub", Aggregator: stubAggregator{maxDays: 14, panics: true}},
+	}
+	for _, p := range pp {
+		if err := providers.Register(p); err != nil {
+			t.Fatalf("register %s stub: %+v", p.ID, err)
+		}
+	}
+
+	sut := api.NewServer(api.Config{Providers: providers})
+
+	srv := httptest.NewServer(sut.Handler())
+	c := srv.Client()
+
+	resp, err := c.Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&days=2", srv.URL))
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Weather endpoint must respond OK, got %s", http.StatusText(resp.StatusCode))
+	}
+
+	var result struct {
+		Providers map[string]struct {
+			Status struct {
+				OK         bool   `json:"ok"`
+				ErrorClass string `json:"error_class"`
+			} `json:"status"`
+		} `json:"providers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to unmarshal API response data, got %+v", err)
+		t.Fatal("Can't verify response integrity, aborting!")
+	}
+
+	if got := result.Providers["weatherapi"].Status; got.OK || got.ErrorClass != "upstream" {
+		t.Errorf("Panicking provider must report an upstream error, got %+v", got)
+	}
+}
+
+type kindStatusTestValues struct {
+	kind           aggregator.Kind
+	retryAfter     time.Duration
+	wantStatus     int
+	wantRetryAfter string
+}
+
+// TestGetWeatherEndpointProviderErrorKinds_MapToStatus verifies the kinds of
+// provider failures end up as fitting status codes for required providers.
+func TestGetWeatherEndpointProviderErrorKinds_MapToStatus(t *testing.T) {
+	rr := []kindStatusTestValues{
+		{kind: aggregator.KindUnavailable, wantStatus: http.StatusBadGateway},
+		{kind: aggregator.KindUnavailable, retryAfter: 90 * time.Second, wantStatus: http.StatusBadGateway, wantRetryAfter: "90"},
+		{kind: aggregator.KindRateLimited, retryAfter: 1500 * time.Millisecond, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "2"},
+		{kind: aggregator.KindAuth, wantStatus: http.StatusServiceUnavailable},
+		{kind: aggregator.KindDecode, wantStatus: http.StatusBadGateway},
+		{kind: aggregator.KindInvalidLocation, wantStatus: http.StatusBadRequest},
+		{kind: aggregator.KindTimeout, wantStatus: http.StatusGatewayTimeout},
+	}
+
+	for _, r := range rr {
+		t.Run(fmt.Sprintf("%s/%s", r.kind, r.retryAfter), func(t *testing.T) {
+			providers := api.NewRegistry()
+			err := providers.Register(api.Provider{
+				ID:   "weatherapi",
+				Name: "WeatherAPI Stub",
+				Aggregator: stubAggregator{maxDays: 14, err: &aggregator.ProviderError{
+					Provider:   "weatherapi",
+					Kind:       r.kind,
+					RetryAfter: r.retryAfter,
+					Err:        errors.New("made up"),
+				}},
+			})
+			if err != nil {
+				t.Fatalf("register stub: %+v", err)
+			}
+
+			sut := api.NewServer(api.Config{Providers: providers})
+
+			srv := httptest.NewServer(sut.Handler())
+			t.Cleanup(srv.Close)
+
+			resp, err := srv.Client().Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753", srv.URL))
+			if err != nil {
+				t.Errorf("Request to internal test server without response, got %+v.", err)
+				t.Fatal("This is bad. Really bad. Technically it should never happen.")
+			}
+
+			if resp.StatusCode != r.wantStatus {
+				t.Errorf(
+					"Weather endpoint %s response mismatch, want %s, got %s",
+					r.kind,
+					http.StatusText(r.wantStatus),
+					http.StatusText(resp.StatusCode),
+				)
+			}
+			if got := resp.Header.Get("Retry-After"); got != r.wantRetryAfter {
+				t.Errorf("Retry-After mismatch, want %#v, got %#v", r.wantRetryAfter, got)
+			}
+		})
+	}
+}
+
+// TestGetWeatherEndpointExhaustedQuota_FlagsProvider verifies a provider that
+// spares its quota is flagged as skipped, and fails required requests with
+// Service Unavailable.
+func TestGetWeatherEndpointExhaustedQuota_FlagsProvider(t *testing.T) {
+	providers := api.NewRegistry()
+	pp := []api.Provider{
+		{ID: "openmeteo", Name: "Open-Meteo Stub", Aggregator: stubAggregator{maxDays: 16, maxTemp: 20}},
+		{ID: "weatherapi", Name: "WeatherAPI Stub", Aggregator: stubAggregator{maxDays: 14, err: &aggregator.ProviderError{
+			Provider:   "weatherapi",
+			Kind:       aggregator.KindRateLimited,
+			RetryAfter: time.Hour,
+			Err:        fmt.Errorf("%w: 999000 of 1000000 calls used", aggregator.ErrQuotaExhausted),
+		}}},
+	}
+	for _, p := range pp {
+		if err := providers.Register(p); err != nil {
+			t.Fatalf("register %s stub: %+v", p.ID, err)
+		}
+	}
+
+	sut := api.NewServer(api.Config{Providers: providers})
+	srv := httptest.NewServer(sut.Handler())
+	t.Cleanup(srv.Close)
+
+	resp, err := srv.Client().Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753", srv.URL))
+	if err != nil {
+		t.Errorf("Request to internal test server without response, got %+v.", err)
+		t.Fatal("This is bad. Really bad. Technically it should never happen.")
+	}
+
+	var result struct {
+		Providers map[string]struct {
+			Status struct {
+				Skipped    bool   `json:"skipped"`
+				ErrorClass string `json:"error_class"`
+			} `json:"status"`
+		} `json:"providers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to unmarshal API response data, got %+v", err)
+		t.Fatal("Can't verify response integrity, aborting!")
+	}
+	if got := result.Providers["weatherapi"].Status; !got.Skipped || got.ErrorClass != "quota_exhausted" {
+		t.Errorf("Provider sparing its quota must be flagged, got %+v", got)
+	}
+
+	required, err := srv.Client().Get(fmt.Sprintf("%s/weather?lat=42.6493934&lon=-8.8201753&require=weatherapi", srv.URL))
+	if err != nil {
+		t.Fatalf("Request to internal test server without response, got %+v.", err)
+	}
+	if required.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Required provider sparing its quota must respond %s, got %s",
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusText(required.StatusCode),
+		)
+	}
+	if got := required.Header.Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After mismatch, want \"3600\", got %#v", got)
+	}
+}
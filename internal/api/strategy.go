@@ -0,0 +1,75 @@
+package api
+
+import "slices"
+
+/*
+Strategy combines the values several aggregators forecast for the same day and
+variable into the one value of the consensus.
+
+The values are never empty and already in the units of the response.
+Implementations must not modify the slice.
+*/
+type Strategy interface {
+	Combine(vv []float64) float64
+}
+
+// Mean is the arithmetic mean of all values.
+type Mean struct{}
+
+// Combine implements the Strategy interface.
+func (Mean) Combine(vv []float64) float64 {
+	var sum float64
+	for _, v := range vv {
+		sum += v
+	}
+	return sum / float64(len(vv))
+}
+
+// Median is the middle value, or the mean of both middle values.
+type Median struct{}
+
+// Combine implements the Strategy interface.
+func (Median) Combine(vv []float64) float64 {
+	sorted := slices.Clone(vv)
+	slices.Sort(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// TrimmedMean drops the Fraction of the lowest and highest values before taking
+// the mean, so a single provider being way off doesn't drag the result along.
+// With three or more values at least one is dropped on each end.
+type TrimmedMean struct {
+	Fraction float64
+}
+
+// Combine implements the Strategy interface.
+func (t TrimmedMean) Combine(vv []float64) float64 {
+	sorted := slices.Clone(vv)
+	slices.Sort(sorted)
+
+	k := int(float64(len(sorted)) * t.Fraction)
+	if k == 0 && len(sorted) >= 3 {
+		k = 1
+	}
+	if 2*k >= len(sorted) {
+		return Median{}.Combine(sorted)
+	}
+	return Mean{}.Combine(sorted[k : len(sorted)-k])
+}
+
+// defaultStrategy names the strategy used if the client doesn't pick one.
+const defaultStrategy = "median"
+
+// defaultStrategies are the strategies every server knows about.
+func defaultStrategies() map[string]Strategy {
+	return map[string]Strategy{
+		"mean":    Mean{},
+		"median":  Median{},
+		"trimmed": TrimmedMean{Fraction: 0.1},
+	}
+}
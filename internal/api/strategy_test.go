@@ -0,0 +1,43 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+)
+
+type strategyTestValues struct {
+	name     string
+	strategy api.Strategy
+	values   []float64
+	want     float64
+}
+
+func TestStrategies(t *testing.T) {
+	rr := []strategyTestValues{
+		{name: "mean of one", strategy: api.Mean{}, values: []float64{19.8}, want: 19.8},
+		{name: "mean", strategy: api.Mean{}, values: []float64{18, 21, 24}, want: 21},
+		{name: "median odd", strategy: api.Median{}, values: []float64{30, 18, 21}, want: 21},
+		{name: "median even", strategy: api.Median{}, values: []float64{22, 18, 21, 30}, want: 21.5},
+		{name: "trimmed two", strategy: api.TrimmedMean{Fraction: 0.1}, values: []float64{18, 22}, want: 20},
+		{name: "trimmed outlier", strategy: api.TrimmedMean{Fraction: 0.1}, values: []float64{35, 20, 21, 22}, want: 21.5},
+		{name: "trimmed everything", strategy: api.TrimmedMean{Fraction: 0.5}, values: []float64{35, 20, 21}, want: 21},
+	}
+
+	for _, r := range rr {
+		t.Run(r.name, func(t *testing.T) {
+			in := append([]float64(nil), r.values...)
+
+			got := r.strategy.Combine(in)
+			if got != r.want {
+				t.Errorf("combined value mismatch, want %v, got %v", r.want, got)
+			}
+
+			for i := range in {
+				if in[i] != r.values[i] {
+					t.Fatalf("Strategy must not modify the values, got %v", in)
+				}
+			}
+		})
+	}
+}
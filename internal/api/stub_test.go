@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// stubAggregator answers with made up forecasts starting at 2024-11-05, so the
+// server tests neither need the internet nor API keys. With err set it fails,
+// with delay set it takes its time without caring about the context and with
+// panics set it panics.
+type stubAggregator struct {
+	maxDays int
+	maxTemp float32
+	err     error
+	delay   time.Duration
+	panics  bool
+}
+
+func (s stubAggregator) AggregateWeather(ctx context.Context, q types.Query) (types.DailyForecast, error) {
+	time.Sleep(s.delay)
+	if s.panics {
+		var rr []types.Forecast
+		return types.DailyForecast{rr[4]}, nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	start := time.Date(2024, 11, 5, 0, 0, 0, 0, time.UTC)
+
+	res := make(types.DailyForecast, 0, q.Days)
+	for i := 0; i < q.Days; i++ {
+		res = append(res, types.Forecast{
+			Date:    start.AddDate(0, 0, i).Format(time.DateOnly),
+			MaxTemp: s.maxTemp,
+			MinTemp: s.maxTemp - 8,
+		})
+	}
+	return res, nil
+}
+
+func (s stubAggregator) MaxForecastDays() int {
+	return s.maxDays
+}
+
+// stubProviders registers stubs with the horizons of OpenMeteo and WeatherAPI.
+func stubProviders(t *testing.T) *api.Registry {
+	t.Helper()
+
+	res := api.NewRegistry()
+	pp := []api.Provider{
+		{
+			ID:          "openmeteo",
+			Name:        "Open-Meteo Stub",
+			Attribution: "Made up for testing",
+			Aggregator:  stubAggregator{maxDays: 16, maxTemp: 20},
+		},
+		{
+			ID:          "weatherapi",
+			Name:        "WeatherAPI Stub",
+			Attribution: "Made up for testing",
+			Aggregator:  stubAggregator{maxDays: 14, maxTemp: 22},
+		},
+	}
+	for _, p := range pp {
+		if err := res.Register(p); err != nil {
+			t.Fatalf("register %s stub: %+v", p.ID, err)
+		}
+	}
+	return res
+}
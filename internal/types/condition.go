@@ -0,0 +1,71 @@
+package types
+
+// Condition is the canonical weather condition of a day or an hour.
+// Every provider maps its own codes onto these, so a "light rain" day looks the
+// same no matter which provider reported it.
+type Condition string
+
+const (
+	ConditionClear            Condition = "clear"
+	ConditionPartlyCloudy     Condition = "partly_cloudy"
+	ConditionCloudy           Condition = "cloudy"
+	ConditionOvercast         Condition = "overcast"
+	ConditionFog              Condition = "fog"
+	ConditionLightDrizzle     Condition = "light_drizzle"
+	ConditionDrizzle          Condition = "drizzle"
+	ConditionFreezingDrizzle  Condition = "freezing_drizzle"
+	ConditionLightRain        Condition = "light_rain"
+	ConditionRain             Condition = "rain"
+	ConditionHeavyRain        Condition = "heavy_rain"
+	ConditionFreezingRain     Condition = "freezing_rain"
+	ConditionRainShowers      Condition = "rain_showers"
+	ConditionSleet            Condition = "sleet"
+	ConditionLightSnow        Condition = "light_snow"
+	ConditionSnow             Condition = "snow"
+	ConditionHeavySnow        Condition = "heavy_snow"
+	ConditionSnowShowers      Condition = "snow_showers"
+	ConditionThunderstorm     Condition = "thunderstorm"
+	ConditionThunderstormHail Condition = "thunderstorm_hail"
+	// ConditionUnknown is used for provider codes without a mapping.
+	ConditionUnknown Condition = "unknown"
+)
+
+// ConditionInfo describes a canonical condition for humans and user interfaces.
+type ConditionInfo struct {
+	Code        Condition `json:"code"`
+	Description string    `json:"description"`
+	Icon        string    `json:"icon"`
+}
+
+// conditionInfos lists all canonical conditions from fair to foul weather.
+var conditionInfos = []ConditionInfo{
+	{Code: ConditionClear, Description: "Clear sky", Icon: "clear"},
+	{Code: ConditionPartlyCloudy, Description: "Partly cloudy", Icon: "partly-cloudy"},
+	{Code: ConditionCloudy, Description: "Cloudy", Icon: "cloudy"},
+	{Code: ConditionOvercast, Description: "Overcast", Icon: "overcast"},
+	{Code: ConditionFog, Description: "Fog or mist", Icon: "fog"},
+	{Code: ConditionLightDrizzle, Description: "Light drizzle", Icon: "drizzle"},
+	{Code: ConditionDrizzle, Description: "Drizzle", Icon: "drizzle"},
+	{Code: ConditionFreezingDrizzle, Description: "Freezing drizzle", Icon: "freezing-drizzle"},
+	{Code: ConditionLightRain, Description: "Light rain", Icon: "light-rain"},
+	{Code: ConditionRain, Description: "Rain", Icon: "rain"},
+	{Code: ConditionHeavyRain, Description: "Heavy rain", Icon: "heavy-rain"},
+	{Code: ConditionFreezingRain, Description: "Freezing rain", Icon: "freezing-rain"},
+	{Code: ConditionRainShowers, Description: "Rain showers", Icon: "showers"},
+	{Code: ConditionSleet, Description: "Sleet or ice pellets", Icon: "sleet"},
+	{Code: ConditionLightSnow, Description: "Light snow", Icon: "light-snow"},
+	{Code: ConditionSnow, Description: "Snow", Icon: "snow"},
+	{Code: ConditionHeavySnow, Description: "Heavy snow", Icon: "heavy-snow"},
+	{Code: ConditionSnowShowers, Description: "Snow showers", Icon: "snow-showers"},
+	{Code: ConditionThunderstorm, Description: "Thunderstorm", Icon: "thunderstorm"},
+	{Code: ConditionThunderstormHail, Description: "Thunderstorm with hail", Icon: "thunderstorm-hail"},
+	{Code: ConditionUnknown, Description: "Unknown condition", Icon: "unknown"},
+}
+
+// AllConditions lists the descriptions of all canonical conditions.
+// The result is a copy, so callers may modify it.
+func AllConditions() []ConditionInfo {
+	res := make([]ConditionInfo, len(conditionInfos))
+	copy(res, conditionInfos)
+	return res
+}
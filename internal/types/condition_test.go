@@ -0,0 +1,31 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/types"
+)
+
+// TestAllConditions_Described verifies every canonical condition comes with a
+// description and an icon name, and none is listed twice.
+func TestAllConditions_Described(t *testing.T) {
+	seen := make(map[types.Condition]bool)
+
+	for _, c := range types.AllConditions() {
+		if seen[c.Code] {
+			t.Errorf("Condition %s listed twice", c.Code)
+		}
+		seen[c.Code] = true
+
+		if c.Description == "" {
+			t.Errorf("Condition %s without description", c.Code)
+		}
+		if c.Icon == "" {
+			t.Errorf("Condition %s without icon", c.Code)
+		}
+	}
+
+	if !seen[types.ConditionUnknown] {
+		t.Error("Unmapped provider codes need the unknown condition")
+	}
+}
@@ -1,19 +1,69 @@
 package types
 
-// FiveDayForecast holds the forecasts for five days.
-// Having it identified with the name makes it a little easier to handle instead
-// of using arrays.
-type FiveDayForecast struct {
-	Day1 Forecast
-	Day2 Forecast
-	Day3 Forecast
-	Day4 Forecast
-	Day5 Forecast
+import "slices"
+
+// Query holds the parameters an aggregator needs to fetch a forecast.
+// Bundling them keeps the Aggregator interface stable when more options arrive.
+type Query struct {
+	Lat  float64
+	Lon  float64
+	Days int
+	// Variables lists the forecast values to fetch. Empty means all of them.
+	Variables []Variable
+	// Hours is the horizon of hourly forecasts, starting with the current hour.
+	Hours int
+}
+
+// Wants tells if the variable v is part of the query.
+func (q Query) Wants(v Variable) bool {
+	if len(q.Variables) == 0 {
+		return true
+	}
+	return slices.Contains(q.Variables, v)
 }
 
-// Forecast holds the corresponding date and maximum temperature in ºC
-// There is more to weather than that, but this is good enough for a quick start.
+// DailyForecast holds one forecast per day, starting with today.
+// The length of the slice is the forecast horizon that was asked for.
+type DailyForecast []Forecast
+
+// Forecast holds the normalized values of one forecast day.
+// Temperatures are in ºC, precipitation in mm, wind speeds in km/h, the wind
+// direction in degrees and probabilities, humidity in percent.
+// Sunrise and Sunset are local ISO 8601 times like "2024-11-09T08:21".
+// Condition is the canonical condition that dominates the day.
+//
+// Only the fields of the queried variables are filled, the others keep their
+// zero value.
 type Forecast struct {
-	Date    string
-	MaxTemp float32
+	Date                     string
+	MaxTemp                  float32
+	MinTemp                  float32
+	PrecipitationSum         float32
+	PrecipitationProbability float32
+	MaxWindSpeed             float32
+	MaxWindGust              float32
+	WindDirection            float32
+	RelativeHumidity         float32
+	UVIndex                  float32
+	Sunrise                  string
+	Sunset                   string
+	Condition                Condition
+}
+
+// HourlyForecast holds one forecast per hour, starting with the current hour.
+type HourlyForecast []HourForecast
+
+// HourForecast holds the normalized values of one forecast hour.
+// Time is the local ISO 8601 time like "2024-11-09T14:00", the units match the
+// ones of Forecast. CloudCover is the share of the sky in percent.
+type HourForecast struct {
+	Time                     string
+	Temp                     float32
+	Precipitation            float32
+	PrecipitationProbability float32
+	WindSpeed                float32
+	WindGust                 float32
+	WindDirection            float32
+	CloudCover               float32
+	Condition                Condition
 }
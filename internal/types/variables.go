@@ -0,0 +1,48 @@
+package types
+
+// Variable names one value of a daily forecast.
+// The string values are the ones clients use in the `variables` parameter.
+type Variable string
+
+const (
+	VarMaxTemp                  Variable = "max_temp"
+	VarMinTemp                  Variable = "min_temp"
+	VarPrecipitationSum         Variable = "precipitation_sum"
+	VarPrecipitationProbability Variable = "precipitation_probability"
+	VarMaxWindSpeed             Variable = "max_wind_speed"
+	VarMaxWindGust              Variable = "max_wind_gust"
+	VarWindDirection            Variable = "wind_direction"
+	VarRelativeHumidity         Variable = "relative_humidity"
+	VarUVIndex                  Variable = "uv_index"
+	VarSunrise                  Variable = "sunrise"
+	VarSunset                   Variable = "sunset"
+	VarCondition                Variable = "condition"
+)
+
+// AllVariables lists every supported variable in the order of the Forecast
+// fields.
+var AllVariables = []Variable{
+	VarMaxTemp,
+	VarMinTemp,
+	VarPrecipitationSum,
+	VarPrecipitationProbability,
+	VarMaxWindSpeed,
+	VarMaxWindGust,
+	VarWindDirection,
+	VarRelativeHumidity,
+	VarUVIndex,
+	VarSunrise,
+	VarSunset,
+	VarCondition,
+}
+
+// ParseVariable looks up the variable for the name s.
+// It reports false if there is no such variable.
+func ParseVariable(s string) (Variable, bool) {
+	for _, v := range AllVariables {
+		if string(v) == s {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,162 @@
+/*
+Package units converts the normalized forecast values into the units a client
+asked for.
+
+Aggregators always deliver ºC, km/h and mm, see types.Forecast. The conversion
+happens once right before the response gets encoded, so there is exactly one
+place that knows about Fahrenheit and knots.
+*/
+package units
+
+import (
+	"fmt"
+	"math"
+)
+
+// Temperature is a unit for temperatures.
+type Temperature string
+
+const (
+	Celsius    Temperature = "C"
+	Fahrenheit Temperature = "F"
+	Kelvin     Temperature = "K"
+)
+
+// Speed is a unit for wind speeds.
+type Speed string
+
+const (
+	KilometersPerHour Speed = "kmh"
+	MetersPerSecond   Speed = "ms"
+	MilesPerHour      Speed = "mph"
+	Knots             Speed = "kn"
+)
+
+// Length is a unit for precipitation amounts.
+type Length string
+
+const (
+	Millimeters Length = "mm"
+	Inches      Length = "in"
+)
+
+// System bundles the units of all quantities of a response.
+// It marshals into the unit symbols, so clients can display them as they are.
+type System struct {
+	Temperature   Temperature `json:"temperature"`
+	Speed         Speed       `json:"wind_speed"`
+	Precipitation Length      `json:"precipitation"`
+}
+
+// The predefined unit systems of the `units` request parameter.
+var (
+	Metric   = System{Temperature: Celsius, Speed: KilometersPerHour, Precipitation: Millimeters}
+	Imperial = System{Temperature: Fahrenheit, Speed: MilesPerHour, Precipitation: Inches}
+	SI       = System{Temperature: Kelvin, Speed: MetersPerSecond, Precipitation: Millimeters}
+)
+
+// ParseSystem looks up the unit system by its name metric, imperial or si.
+func ParseSystem(s string) (System, error) {
+	switch s {
+	case "metric":
+		return Metric, nil
+	case "imperial":
+		return Imperial, nil
+	case "si":
+		return SI, nil
+	default:
+		return System{}, fmt.Errorf("unknown unit system %#v", s)
+	}
+}
+
+// ParseTemperature looks up the temperature unit C, F or K.
+func ParseTemperature(s string) (Temperature, error) {
+	switch t := Temperature(s); t {
+	case Celsius, Fahrenheit, Kelvin:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown temperature unit %#v", s)
+	}
+}
+
+// ParseSpeed looks up the speed unit kmh, ms, mph or kn.
+func ParseSpeed(s string) (Speed, error) {
+	switch v := Speed(s); v {
+	case KilometersPerHour, MetersPerSecond, MilesPerHour, Knots:
+		return v, nil
+	default:
+		return "", fmt.Errorf("unknown speed unit %#v", s)
+	}
+}
+
+// ParseLength looks up the length unit mm or in.
+func ParseLength(s string) (Length, error) {
+	switch l := Length(s); l {
+	case Millimeters, Inches:
+		return l, nil
+	default:
+		return "", fmt.Errorf("unknown length unit %#v", s)
+	}
+}
+
+// FromCelsius converts the temperature c in ºC into the unit t.
+func (t Temperature) FromCelsius(c float32) float32 {
+	switch t {
+	case Fahrenheit:
+		return round(float64(c)*9/5 + 32)
+	case Kelvin:
+		return round(float64(c) + 273.15)
+	default:
+		return c
+	}
+}
+
+// FromKilometersPerHour converts the speed v in km/h into the unit s.
+func (s Speed) FromKilometersPerHour(v float32) float32 {
+	switch s {
+	case MetersPerSecond:
+		return round(float64(v) / 3.6)
+	case MilesPerHour:
+		return round(float64(v) / 1.609344)
+	case Knots:
+		return round(float64(v) / 1.852)
+	default:
+		return v
+	}
+}
+
+// FromMillimeters converts the length v in mm into the unit l.
+func (l Length) FromMillimeters(v float32) float32 {
+	switch l {
+	case Inches:
+		return round(float64(v) / 25.4)
+	default:
+		return v
+	}
+}
+
+// MarshalText writes the symbol of the temperature unit, like "°F".
+// Kelvin is an absolute scale and comes without the degree sign.
+func (t Temperature) MarshalText() ([]byte, error) {
+	if t == Kelvin {
+		return []byte(t), nil
+	}
+	return []byte("°" + string(t)), nil
+}
+
+// MarshalText writes the symbol of the speed unit, like "km/h".
+func (s Speed) MarshalText() ([]byte, error) {
+	switch s {
+	case KilometersPerHour:
+		return []byte("km/h"), nil
+	case MetersPerSecond:
+		return []byte("m/s"), nil
+	default:
+		return []byte(s), nil
+	}
+}
+
+// round cuts off conversion noise like 71.600006 after two decimals.
+func round(v float64) float32 {
+	return float32(math.Round(v*100) / 100)
+}
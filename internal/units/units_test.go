@@ -0,0 +1,66 @@
+package units_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/units"
+)
+
+type conversionTestValues struct {
+	name string
+	got  float32
+	want float32
+}
+
+func TestConversions(t *testing.T) {
+	rr := []conversionTestValues{
+		{name: "C to C", got: units.Celsius.FromCelsius(21.9), want: 21.9},
+		{name: "C to F", got: units.Fahrenheit.FromCelsius(22), want: 71.6},
+		{name: "freezing to F", got: units.Fahrenheit.FromCelsius(0), want: 32},
+		{name: "C to K", got: units.Kelvin.FromCelsius(-273.15), want: 0},
+		{name: "km/h to m/s", got: units.MetersPerSecond.FromKilometersPerHour(36), want: 10},
+		{name: "km/h to mph", got: units.MilesPerHour.FromKilometersPerHour(100), want: 62.14},
+		{name: "km/h to kn", got: units.Knots.FromKilometersPerHour(18.52), want: 10},
+		{name: "mm to in", got: units.Inches.FromMillimeters(25.4), want: 1},
+		{name: "mm to mm", got: units.Millimeters.FromMillimeters(3.2), want: 3.2},
+	}
+
+	for _, r := range rr {
+		t.Run(r.name, func(t *testing.T) {
+			if r.got != r.want {
+				t.Errorf("conversion mismatch, want %v, got %v", r.want, r.got)
+			}
+		})
+	}
+}
+
+func TestParseSystem_UnknownName(t *testing.T) {
+	if _, err := units.ParseSystem("nautical"); err == nil {
+		t.Error("Unknown unit system must be rejected")
+	}
+}
+
+func TestSystemMarshalsSymbols(t *testing.T) {
+	data, err := json.Marshal(units.Metric)
+	if err != nil {
+		t.Fatalf("Marshal metric system: %+v", err)
+	}
+
+	got := string(data)
+	want := `{"temperature":"°C","wind_speed":"km/h","precipitation":"mm"}`
+	if got != want {
+		t.Errorf("unit symbols mismatch, want %s, got %s", want, got)
+	}
+
+	data, err = json.Marshal(units.SI)
+	if err != nil {
+		t.Fatalf("Marshal SI system: %+v", err)
+	}
+
+	got = string(data)
+	want = `{"temperature":"K","wind_speed":"m/s","precipitation":"mm"}`
+	if got != want {
+		t.Errorf("unit symbols mismatch, want %s, got %s", want, got)
+	}
+}
@@ -5,17 +5,23 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/ardanlabs/conf/v3"
 	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
 )
 
-// config struct holds the applications setting, mostly required for the API key.
-// Thanks to the `conf` annotations it will work with parameters, config files
-// and environment variables.
+// config struct holds the applications setting, mostly the providers and their
+// API keys. Thanks to the `conf` annotations it will work with parameters,
+// config files and environment variables.
+//
+// The embedded provider settings keep their flags short, like --weather-api-key.
+// RequestTimeout is the overall deadline of a forecast request, no matter how
+// long the single providers may take.
 type config struct {
-	Host          string `conf:"default::8080"`
-	WeatherApiKey string `conf:"required"`
+	Host           string        `conf:"default::8080"`
+	RequestTimeout time.Duration `conf:"default:10s"`
+	ProvidersConfig
 }
 
 // main parses the app configuration and hands over to some error-aware function.
@@ -53,9 +59,15 @@ func main() {
 // I guess one could add things to it so the config parsing could be done here
 // as well.
 func run(logger *slog.Logger, cfg config) error {
+	providers, err := newRegistry(cfg.ProvidersConfig)
+	if err != nil {
+		return fmt.Errorf("set up providers: %w", err)
+	}
+
 	srvConf := api.Config{
-		Logger:        logger,
-		WeatherApiKey: cfg.WeatherApiKey,
+		Logger:         logger,
+		Providers:      providers,
+		RequestTimeout: cfg.RequestTimeout,
 	}
 	srv := api.NewServer(srvConf)
 	if err := http.ListenAndServe(cfg.Host, srv.Handler()); err != nil {
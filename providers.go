@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/meteogalicia"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/metno"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/openmeteo"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/openweathermap"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/aggregator/weatherapi"
+	"github.com/marcofeltmann/weather-forecast-aggregator/internal/api"
+)
+
+// ProvidersConfig holds the settings of all weather providers. It is exported
+// only because conf ignores unexported embedded structs.
+// Order lists the provider IDs in the order they are asked. Disabled providers
+// are skipped, so they don't need their settings like API keys. Neither do
+// providers missing in the Order.
+type ProvidersConfig struct {
+	Order          []string `conf:"default:openmeteo;weatherapi,flag:providers,env:PROVIDERS"`
+	OpenMeteo      openMeteoConfig
+	WeatherApi     weatherApiConfig
+	OpenWeatherMap openWeatherMapConfig
+	MetNorway      metNorwayConfig
+	MeteoGalicia   meteoGaliciaConfig
+}
+
+// openMeteoConfig holds the OpenMeteo settings. It works without an API key.
+// URL points to the API, i.e. a self-hosted instance or a local stand-in.
+// Timeout limits how long a request waits for OpenMeteo.
+type openMeteoConfig struct {
+	Enabled bool          `conf:"default:true"`
+	URL     string        `conf:"default:https://api.open-meteo.com"`
+	Timeout time.Duration `conf:"default:8s"`
+	Retry   retryConfig
+	Breaker breakerConfig
+}
+
+// weatherApiConfig holds the WeatherAPI settings. See ADR-01 for the key.
+// URL points to the API, i.e. a corporate mirror or a local stand-in.
+// Timeout limits how long a request waits for WeatherAPI.
+type weatherApiConfig struct {
+	Enabled bool          `conf:"default:true"`
+	Key     string        `conf:"mask"`
+	URL     string        `conf:"default:https://api.weatherapi.com"`
+	Timeout time.Duration `conf:"default:8s"`
+	Retry   retryConfig
+	Breaker breakerConfig
+	Quota   quotaConfig
+}
+
+// openWeatherMapConfig holds the OpenWeatherMap settings. The key works with
+// the free plan, which only offers the 5 day / 3 hour forecast.
+type openWeatherMapConfig struct {
+	Enabled bool          `conf:"default:true"`
+	Key     string        `conf:"mask"`
+	URL     string        `conf:"default:https://api.openweathermap.org"`
+	Timeout time.Duration `conf:"default:8s"`
+	Retry   retryConfig
+	Breaker breakerConfig
+}
+
+// metNorwayConfig holds the MET Norway settings. It works without an API key,
+// but its terms of service ask for a UserAgent naming the application and a way
+// to contact its operators. A caching proxy at URL takes load off MET Norway.
+type metNorwayConfig struct {
+	Enabled   bool          `conf:"default:true"`
+	UserAgent string        `conf:"default:weather-forecast-aggregator github.com/marcofeltmann/weather-forecast-aggregator"`
+	URL       string        `conf:"default:https://api.met.no"`
+	Timeout   time.Duration `conf:"default:8s"`
+	Retry     retryConfig
+	Breaker   breakerConfig
+}
+
+// meteoGaliciaConfig holds the MeteoGalicia settings. See ADR-01 for the key,
+// which MeteoGalicia hands out on request for its MeteoSIX API.
+type meteoGaliciaConfig struct {
+	Enabled bool          `conf:"default:true"`
+	Key     string        `conf:"mask"`
+	URL     string        `conf:"default:https://servizos.meteogalicia.gal"`
+	Timeout time.Duration `conf:"default:8s"`
+	Retry   retryConfig
+	Breaker breakerConfig
+}
+
+// quotaConfig holds the budget of calls the WeatherAPI key may use per day or
+// month. Once no more than Reserve calls are left WeatherAPI is skipped.
+// The counters survive restarts in File, which is written at most every Flush.
+// Zero Budget turns the tracking off.
+type quotaConfig struct {
+	Budget  int           `conf:"default:1000000"`
+	Period  string        `conf:"default:month"`
+	Reserve int           `conf:"default:1000"`
+	File    string        `conf:"default:weatherapi-quota.json"`
+	Flush   time.Duration `conf:"default:10s"`
+}
+
+// retryConfig holds how often and how patiently failed calls of a provider are
+// repeated. Budget is the number of retries per call, so zero turns them off.
+type retryConfig struct {
+	Budget    int           `conf:"default:2"`
+	BaseDelay time.Duration `conf:"default:200ms"`
+	MaxDelay  time.Duration `conf:"default:2s"`
+}
+
+// breakerConfig holds the thresholds of the circuit breaker of a provider.
+// Failures is the number of failed calls in a row that open the breaker, so zero
+// turns it off. Cooldown is the time until an open breaker tries again.
+type breakerConfig struct {
+	Failures int           `conf:"default:5"`
+	Cooldown time.Duration `conf:"default:30s"`
+}
+
+// thresholds converts the settings into the api.BreakerConfig.
+func (c breakerConfig) thresholds() api.BreakerConfig {
+	return api.BreakerConfig{
+		Failures: c.Failures,
+		Cooldown: c.Cooldown,
+	}
+}
+
+// policy converts the settings into the aggregator.RetryPolicy.
+func (c retryConfig) policy() aggregator.RetryPolicy {
+	return aggregator.RetryPolicy{
+		Budget:    c.Budget,
+		BaseDelay: c.BaseDelay,
+		MaxDelay:  c.MaxDelay,
+	}
+}
+
+// newRegistry creates the enabled providers and registers them in the
+// configured order.
+func newRegistry(cfg ProvidersConfig) (*api.Registry, error) {
+	res := api.NewRegistry()
+
+	for _, id := range cfg.Order {
+		p, err := newProvider(id, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("create provider %s: %w", id, err)
+		}
+		if p == nil {
+			continue
+		}
+
+		if err := res.Register(*p); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// newProvider creates the provider with the ID id. It returns nil if the
+// provider is disabled.
+func newProvider(id string, cfg ProvidersConfig) (*api.Provider, error) {
+	switch id {
+	case openmeteo.ProviderName:
+		if !cfg.OpenMeteo.Enabled {
+			return nil, nil
+		}
+		base, err := baseURL(cfg.OpenMeteo.URL)
+		if err != nil {
+			return nil, err
+		}
+		return &api.Provider{
+			ID:             openmeteo.ProviderName,
+			Name:           openmeteo.DisplayName,
+			Attribution:    openmeteo.Attribution,
+			AttributionURL: openmeteo.AttributionURL,
+			Timeout:        cfg.OpenMeteo.Timeout,
+			Breaker:        cfg.OpenMeteo.Breaker.thresholds(),
+			Aggregator:     openmeteo.NewCaller(base, cfg.OpenMeteo.Retry.policy()),
+		}, nil
+
+	case weatherapi.ProviderName:
+		if !cfg.WeatherApi.Enabled {
+			return nil, nil
+		}
+		base, err := baseURL(cfg.WeatherApi.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		var quota *weatherapi.Quota
+		if q := cfg.WeatherApi.Quota; q.Budget > 0 {
+			quota, err = weatherapi.NewQuota(weatherapi.QuotaConfig{
+				Budget:  q.Budget,
+				Period:  weatherapi.Period(q.Period),
+				Reserve: q.Reserve,
+				File:    q.File,
+				Flush:   q.Flush,
+			}, cfg.WeatherApi.Key, time.Now)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		a, err := weatherapi.NewCaller(cfg.WeatherApi.Key, base, cfg.WeatherApi.Retry.policy(), quota)
+		if err != nil {
+			return nil, err
+		}
+		return &api.Provider{
+			ID:             weatherapi.ProviderName,
+			Name:           weatherapi.DisplayName,
+			Attribution:    weatherapi.Attribution,
+			AttributionURL: weatherapi.AttributionURL,
+			Timeout:        cfg.WeatherApi.Timeout,
+			Breaker:        cfg.WeatherApi.Breaker.thresholds(),
+			Aggregator:     a,
+		}, nil
+
+	case openweathermap.ProviderName:
+		if !cfg.OpenWeatherMap.Enabled {
+			return nil, nil
+		}
+		base, err := baseURL(cfg.OpenWeatherMap.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := openweathermap.NewCaller(cfg.OpenWeatherMap.Key, base, cfg.OpenWeatherMap.Retry.policy())
+		if err != nil {
+			return nil, err
+		}
+		return &api.Provider{
+			ID:             openweathermap.ProviderName,
+			Name:           openweathermap.DisplayName,
+			Attribution:    openweathermap.Attribution,
+			AttributionURL: openweathermap.AttributionURL,
+			Timeout:        cfg.OpenWeatherMap.Timeout,
+			Breaker:        cfg.OpenWeatherMap.Breaker.thresholds(),
+			Aggregator:     a,
+		}, nil
+
+	case metno.ProviderName:
+		if !cfg.MetNorway.Enabled {
+			return nil, nil
+		}
+		base, err := baseURL(cfg.MetNorway.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := metno.NewCaller(cfg.MetNorway.UserAgent, base, cfg.MetNorway.Retry.policy())
+		if err != nil {
+			return nil, err
+		}
+		return &api.Provider{
+			ID:             metno.ProviderName,
+			Name:           metno.DisplayName,
+			Attribution:    metno.Attribution,
+			AttributionURL: metno.AttributionURL,
+			Timeout:        cfg.MetNorway.Timeout,
+			Breaker:        cfg.MetNorway.Breaker.thresholds(),
+			Aggregator:     a,
+		}, nil
+
+	case meteogalicia.ProviderName:
+		if !cfg.MeteoGalicia.Enabled {
+			return nil, nil
+		}
+		base, err := baseURL(cfg.MeteoGalicia.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := meteogalicia.NewCaller(cfg.MeteoGalicia.Key, base, cfg.MeteoGalicia.Retry.policy())
+		if err != nil {
+			return nil, err
+		}
+		return &api.Provider{
+			ID:             meteogalicia.ProviderName,
+			Name:           meteogalicia.DisplayName,
+			Attribution:    meteogalicia.Attribution,
+			AttributionURL: meteogalicia.AttributionURL,
+			Timeout:        cfg.MeteoGalicia.Timeout,
+			Breaker:        cfg.MeteoGalicia.Breaker.thresholds(),
+			Aggregator:     a,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown provider")
+	}
+}
+
+// baseURL parses the configured base URL of a provider. Empty ones fall back to
+// the provider's default.
+func baseURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	res, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse base URL: %w", err)
+	}
+	if res.Scheme != "http" && res.Scheme != "https" || res.Host == "" {
+		return nil, fmt.Errorf("base URL %s must be http(s) with host", s)
+	}
+	return res, nil
+}